@@ -2,6 +2,7 @@ package ast
 
 import ("monkey/token"
 		"bytes"
+		"strings"
 	   )
 
 // ============================== 接口定义 ============================== //
@@ -67,7 +68,7 @@ type InfixExpression struct {
 	Right Expression
 }
 
-type Boolean struct {
+type BooleanLiteral struct {
 	Token token.Token
 	Value bool
 }
@@ -145,8 +146,31 @@ func (i *Identifier)String() string {
 }
 
 func (il *IntegerLiteral) expressionNode()   {}
-func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
-func (il *IntegerLiteral) String() string { return il.Token.Literal }
+// TokenLiteral drops the leading zeros of a decimal integer: 007 is 7.
+// Token.Literal keeps the literal as written, for the formatter
+func (il *IntegerLiteral) TokenLiteral() string { return trimLeadingZeros(il.Token.Literal) }
+func (il *IntegerLiteral) String() string { return il.TokenLiteral() }
+
+// leading zeros of a decimal integer don't make it octal, drop them. a base
+// prefix like 0x stops the loop at once
+func trimLeadingZeros(literal string) string {
+	i := 0
+	for i < len(literal)-1 && (literal[i] == '0' || literal[i] == '_') &&
+		('0' <= literal[i+1] && literal[i+1] <= '9' || literal[i+1] == '_') {
+		i++
+	}
+
+	return literal[i:]
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 func (pl *PrefixExpression) expressionNode()  {}
 func (pl *PrefixExpression) TokenLiteral() string { return pl.Token.Literal }
@@ -175,6 +199,325 @@ func (il *InfixExpression) String() string {
 	return out.String()
 }
 
-func (b *Boolean) expressionNode()             {}
-func (b *Boolean) TokenLiteral() string        { return b.Token.Literal }
-func (b *Boolean) String() string              { return b.Token.Literal }
\ No newline at end of file
+func (b *BooleanLiteral) expressionNode()      {}
+func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
+func (b *BooleanLiteral) String() string       { return b.Token.Literal }
+type BlockStatement struct {
+	Token token.Token     // { token
+	Statements []Statement
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
+type IfExpression struct {
+	Token token.Token     // if token
+	Condition Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// 函数的形参列表
+type IdentifierList []*Identifier
+
+func (il IdentifierList) String() string {
+	params := make([]string, 0, len(il))
+	for _, p := range il {
+		params = append(params, p.String())
+	}
+
+	return strings.Join(params, ", ")
+}
+
+type FunctionLiteral struct {
+	Token token.Token     // fn token
+	Parameters IdentifierList
+	Body *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(fl.Parameters.String())
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+type CallExpression struct {
+	Token token.Token     // ( token
+	Function Expression   // Identifier or FunctionLiteral
+	Arguments []Expression
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+type ArrayLiteral struct {
+	Token token.Token     // [ token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token token.Token     // [ token
+	Left Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+type HashLiteral struct {
+	Token token.Token     // { token
+	Pairs map[Expression]Expression
+	Keys []Expression     // map没有顺序，按源码顺序记录key
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// MemberExpression is h.key, a shorthand of h["key"]
+type MemberExpression struct {
+	Token token.Token     // . token
+	Object Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Property.String() + ")"
+}
+
+// AssignExpression is x = v or a compound assignment like x += v. Target is an
+// Identifier, an IndexExpression or a MemberExpression
+type AssignExpression struct {
+	Token token.Token     // = token, or += -= *= /= %=
+	Target Expression
+	Operator string
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ========================= 循环 ========================= //
+// WhileStatement : while (Condition) { Body }
+type WhileStatement struct {
+	Token token.Token     // while token
+	Condition Expression
+	Body *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement : for (Init; Condition; Update) { Body }, each of the three
+// clauses may be nil
+type ForStatement struct {
+	Token token.Token     // for token
+	Init Statement        // LetStatement or ExpressionStatement
+	Condition Expression
+	Update Expression
+	Body *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Update != nil {
+		out.WriteString(fs.Update.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// ForInStatement : for (Variable in Iterable) { Body }
+type ForInStatement struct {
+	Token token.Token     // for token
+	Variable *Identifier
+	Iterable Expression
+	Body *BlockStatement
+}
+
+func (fi *ForInStatement) statementNode()       {}
+func (fi *ForInStatement) TokenLiteral() string { return fi.Token.Literal }
+func (fi *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fi.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fi.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fi.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token     // break token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token     // continue token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+// BadExpression is a placeholder for an expression that could not be parsed
+type BadExpression struct {
+	Token token.Token     // the token where the parser gave up
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) String() string       { return "<bad expression>" }
+
+// BadStatement covers the tokens the parser skipped when recovering from an error
+type BadStatement struct {
+	Token token.Token     // first token of the statement
+	End token.Position    // position of the last skipped token
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
@@ -1,7 +1,13 @@
 package ast
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"monkey/token"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,4 +30,557 @@ func TestString(t *testing.T) {
     if program.String() != "let myVar = anotherVar;" {
         t.Errorf("program.String() wrong. got=%q", program.String())
     }
-}
\ No newline at end of file
+}
+// ident and integer build leaves for the hand written trees below
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+}
+
+// walkTestProgram is
+//
+//	let f = fn(a) { if (a > 1) { a[0] } else { h.k = {"k": -a} } };
+//	for (let i = 0; i < 3; i += 1) { break }
+//	for (x in f) { continue }
+func walkTestProgram() *Program {
+	key := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "k"}, Value: "k"}
+	neg := &PrefixExpression{Token: token.Token{Type: token.MINUS, Literal: "-"}, Operator: "-", Right: ident("a")}
+
+	return &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("f"),
+			Value: &FunctionLiteral{
+				Parameters: IdentifierList{ident("a")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &IfExpression{
+						Condition: &InfixExpression{Left: ident("a"), Operator: ">", Right: integer(1)},
+						Consequence: &BlockStatement{Statements: []Statement{
+							&ExpressionStatement{Expression: &IndexExpression{Left: ident("a"), Index: integer(0)}},
+						}},
+						Alternative: &BlockStatement{Statements: []Statement{
+							&ExpressionStatement{Expression: &AssignExpression{
+								Target:   &MemberExpression{Object: ident("h"), Property: ident("k")},
+								Operator: "=",
+								Value:    &HashLiteral{Keys: []Expression{key}, Pairs: map[Expression]Expression{key: neg}},
+							}},
+						}},
+					}},
+				}},
+			},
+		},
+		&ForStatement{
+			Init:      &LetStatement{Name: ident("i"), Value: integer(0)},
+			Condition: &InfixExpression{Left: ident("i"), Operator: "<", Right: integer(3)},
+			Update:    &AssignExpression{Target: ident("i"), Operator: "+=", Value: integer(1)},
+			Body:      &BlockStatement{Statements: []Statement{&BreakStatement{}}},
+		},
+		&ForInStatement{
+			Variable: ident("x"),
+			Iterable: ident("f"),
+			Body:     &BlockStatement{Statements: []Statement{&ContinueStatement{}}},
+		},
+	}}
+}
+
+func TestInspect(t *testing.T) {
+	var got []string
+	Inspect(walkTestProgram(), func(n Node) bool {
+		switch n := n.(type) {
+		case *Identifier:
+			got = append(got, n.Value)
+		case *IntegerLiteral:
+			got = append(got, n.Token.Literal)
+		case *StringLiteral:
+			got = append(got, strconv.Quote(n.Value))
+		case *InfixExpression:
+			got = append(got, n.Operator)
+		case *PrefixExpression:
+			got = append(got, n.Operator)
+		case *AssignExpression:
+			got = append(got, n.Operator)
+		}
+		return true
+	})
+
+	expected := "f a > a 1 a 0 = h k \"k\" - a i 0 < i 3 += i 1 x f"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("wrong order:\n got %q\nwant %q", strings.Join(got, " "), expected)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	// 不进入函数体
+	count := 0
+	Inspect(walkTestProgram(), func(n Node) bool {
+		if n != nil {
+			count++
+		}
+		_, isFn := n.(*FunctionLiteral)
+		return !isFn
+	})
+
+	// Program, Let, f, fn, For, Let, i, 0, <, i, 3, +=, i, 1, Block, Break, ForIn, x, f, Block, Continue
+	if count != 21 {
+		t.Errorf("visited %d nodes, want 21", count)
+	}
+}
+
+// depthVisitor checks that every Visit(node) is closed by a Visit(nil)
+type depthVisitor struct {
+	depth    *int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.maxDepth {
+		*v.maxDepth = *v.depth
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	depth, maxDepth := 0, 0
+	Walk(depthVisitor{&depth, &maxDepth}, walkTestProgram())
+
+	if depth != 0 {
+		t.Errorf("depth is %d after the walk, want 0", depth)
+	}
+	// Program > Let > fn > Block > ExprStmt > If > Block > ExprStmt > Assign > Hash > Prefix > a
+	if maxDepth != 12 {
+		t.Errorf("max depth is %d, want 12", maxDepth)
+	}
+}
+
+// every node type must be known by Walk, even with all its children missing
+func TestWalkAllNodeTypes(t *testing.T) {
+	nodes := []Node{
+		&Program{}, &LetStatement{}, &ReturnStatement{}, &ExpressionStatement{},
+		&BlockStatement{}, &WhileStatement{}, &ForStatement{}, &ForInStatement{},
+		&BreakStatement{}, &ContinueStatement{}, &BadStatement{},
+		&Identifier{}, &IntegerLiteral{}, &FloatLiteral{}, &BooleanLiteral{},
+		&StringLiteral{}, &ArrayLiteral{}, &HashLiteral{}, &FunctionLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &IfExpression{}, &CallExpression{},
+		&IndexExpression{}, &MemberExpression{}, &AssignExpression{}, &BadExpression{},
+	}
+
+	for _, node := range nodes {
+		visited := 0
+		Inspect(node, func(n Node) bool {
+			if n != nil {
+				visited++
+			}
+			return true
+		})
+		if visited != 1 {
+			t.Errorf("%T: visited %d nodes, want 1", node, visited)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return integer(1) }
+	two := func() Expression { return integer(2) }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&ReturnStatement{}, &ReturnStatement{}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{
+			&FunctionLiteral{
+				Parameters: IdentifierList{ident("a")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&FunctionLiteral{
+				Parameters: IdentifierList{ident("a")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), two()}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&MemberExpression{Object: &IndexExpression{Left: ident("h"), Index: one()}, Property: ident("k")},
+			&MemberExpression{Object: &IndexExpression{Left: ident("h"), Index: two()}, Property: ident("k")},
+		},
+		{
+			&AssignExpression{Target: &IndexExpression{Left: ident("a"), Index: one()}, Operator: "+=", Value: one()},
+			&AssignExpression{Target: &IndexExpression{Left: ident("a"), Index: two()}, Operator: "+=", Value: two()},
+		},
+		{
+			&WhileStatement{Condition: one(), Body: &BlockStatement{Statements: []Statement{&BreakStatement{}}}},
+			&WhileStatement{Condition: two(), Body: &BlockStatement{Statements: []Statement{&BreakStatement{}}}},
+		},
+		{
+			&ForStatement{
+				Init:      &LetStatement{Name: ident("i"), Value: one()},
+				Condition: one(),
+				Update:    one(),
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&ForStatement{
+				Init:      &LetStatement{Name: ident("i"), Value: two()},
+				Condition: two(),
+				Update:    two(),
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ForStatement{Body: &BlockStatement{}}, &ForStatement{Body: &BlockStatement{}}},
+		{
+			&ForInStatement{Variable: ident("x"), Iterable: &ArrayLiteral{Elements: []Expression{one()}}, Body: &BlockStatement{}},
+			&ForInStatement{Variable: ident("x"), Iterable: &ArrayLiteral{Elements: []Expression{two()}}, Body: &BlockStatement{}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyHashLiteral(t *testing.T) {
+	keyOne, valueOne := integer(1), integer(1)
+	keyTwo, valueTwo := integer(5), integer(1)
+	hash := &HashLiteral{
+		Keys:  []Expression{keyOne, keyTwo},
+		Pairs: map[Expression]Expression{keyOne: valueOne, keyTwo: valueTwo},
+	}
+
+	double := func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			return &IntegerLiteral{Token: integer.Token, Value: integer.Value * 2}
+		}
+		return node
+	}
+	Modify(hash, double)
+
+	if len(hash.Keys) != 2 || len(hash.Pairs) != 2 {
+		t.Fatalf("hash has %d keys and %d pairs, want 2 and 2", len(hash.Keys), len(hash.Pairs))
+	}
+	for i, want := range []int64{2, 10} {
+		key := hash.Keys[i].(*IntegerLiteral)
+		if key.Value != want {
+			t.Errorf("key %d is %d, want %d", i, key.Value, want)
+		}
+		value, ok := hash.Pairs[key]
+		if !ok {
+			t.Errorf("key %d is not in Pairs", i)
+			continue
+		}
+		if value.(*IntegerLiteral).Value != 2 {
+			t.Errorf("value %d is %d, want 2", i, value.(*IntegerLiteral).Value)
+		}
+	}
+}
+
+func TestModifyKeepsTokens(t *testing.T) {
+	program := walkTestProgram()
+	let := program.Statements[0].(*LetStatement)
+	fn := let.Value
+
+	rename := func(node Node) Node {
+		if id, ok := node.(*Identifier); ok && id.Value == "h" {
+			return ident("g")
+		}
+		return node
+	}
+	Modify(program, rename)
+
+	// 没有被替换的节点保持原样
+	if let.Token.Literal != "let" || program.Statements[0] != let || let.Value != fn {
+		t.Errorf("untouched nodes were replaced")
+	}
+	if !strings.Contains(program.String(), "(g.k)") {
+		t.Errorf("h was not renamed: %s", program.String())
+	}
+}
+
+func TestModifyWrongReplacement(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Modify did not panic")
+		}
+	}()
+
+	toNumber := func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return integer(1)
+		}
+		return node
+	}
+	Modify(&LetStatement{Name: ident("x"), Value: integer(2)}, toNumber)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	pos := token.Position{Filename: "a.mk", Offset: 4, Line: 1, Column: 5, RuneColumn: 5}
+	comment := token.Token{Type: token.COMMENT, Literal: "// x", Pos: token.Position{Line: 1, Column: 1}}
+
+	programs := []*Program{
+		walkTestProgram(),
+		{Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Comments: []token.Token{comment}},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: pos}, Value: "x"},
+				Value: &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "1.5"}, Value: 1.5},
+			},
+			&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function:  &FunctionLiteral{Parameters: IdentifierList{}, Body: &BlockStatement{Statements: []Statement{}}},
+				Arguments: []Expression{&BooleanLiteral{Value: true}, &StringLiteral{Value: "s\n\"q\""}},
+			}},
+			&WhileStatement{Condition: &BadExpression{}, Body: &BlockStatement{}},
+			&BadStatement{Token: token.Token{Type: token.ILLEGAL, Literal: "@"}, End: pos},
+			&ExpressionStatement{Expression: &IfExpression{Condition: ident("c"), Consequence: &BlockStatement{}}},
+		}},
+	}
+
+	for i, program := range programs {
+		data, err := MarshalJSON(program)
+		if err != nil {
+			t.Fatalf("program %d: MarshalJSON: %v", i, err)
+		}
+		if !json.Valid(data) || !bytes.HasPrefix(data, []byte(`{"type":"Program"`)) {
+			t.Fatalf("program %d: bad JSON: %s", i, data)
+		}
+
+		node, err := UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("program %d: UnmarshalJSON: %v", i, err)
+		}
+		if node.String() != program.String() {
+			t.Errorf("program %d: got %q, want %q", i, node.String(), program.String())
+		}
+
+		again, err := MarshalJSON(node)
+		if err != nil {
+			t.Fatalf("program %d: MarshalJSON after decoding: %v", i, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("program %d: JSON changed after a round trip:\n%s\n%s", i, data, again)
+		}
+	}
+
+	// 没有hash的树可以直接比较
+	node, _ := UnmarshalJSON(mustMarshal(t, programs[1]))
+	if !reflect.DeepEqual(node, programs[1]) {
+		t.Errorf("not equal. got=%#v, want=%#v", node, programs[1])
+	}
+}
+
+func mustMarshal(t *testing.T, node Node) []byte {
+	data, err := MarshalJSON(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestJSONFormat(t *testing.T) {
+	data := mustMarshal(t, &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Offset: 2, Line: 1, Column: 3, RuneColumn: 3}}, Value: "x"})
+	expected := `{"type":"Identifier","token":{"type":"IDENT","literal":"x","pos":{"offset":2,"line":1,"column":3,"runeColumn":3},"end":{"offset":0,"line":0,"column":0,"runeColumn":0}},"value":"x"}`
+
+	if string(data) != expected {
+		t.Errorf("got %s\nwant %s", data, expected)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1]`, "ast: json: cannot unmarshal array"},
+		{`{"value": 1}`, `ast: node without a type: {"value": 1}`},
+		{`{"type": "Loop"}`, `ast: unknown node type "Loop"`},
+		{`{"type": "IntegerLiteral", "value": "one"}`, "ast: IntegerLiteral.value: json: cannot unmarshal string"},
+		{`{"type": "ExpressionStatement", "expression": {"type": "BreakStatement"}}`, "ast: ExpressionStatement.expression: *ast.BreakStatement is not an expression"},
+		{`{"type": "LetStatement", "name": {"type": "IntegerLiteral"}}`, "ast: LetStatement.name: *ast.IntegerLiteral is not an identifier"},
+		{`{"type": "Program", "statements": [{"type": "Identifier"}]}`, "ast: Program.statements: *ast.Identifier is not a statement"},
+	}
+
+	// encoding/json的报错信息只比较开头
+	for _, tt := range tests {
+		_, err := UnmarshalJSON([]byte(tt.input))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: error is %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &InfixExpression{
+			Left:     &PrefixExpression{Operator: "-", Right: ident("a")},
+			Operator: "*",
+			Right:    &StringLiteral{Value: `say "hi"`},
+		}},
+	}}
+
+	expected := `digraph AST {
+	ordering=out;
+	node [shape=box, fontname="monospace"];
+	n0 [label="Program"];
+	n1 [label="ExpressionStatement"];
+	n0 -> n1;
+	n2 [label="InfixExpression\n*"];
+	n1 -> n2;
+	n3 [label="PrefixExpression\n-"];
+	n2 -> n3;
+	n4 [label="Identifier\na"];
+	n3 -> n4;
+	n5 [label="StringLiteral\n\"say \\\"hi\\\"\""];
+	n2 -> n5;
+}
+`
+	if got := ToDOT(program); got != expected {
+		t.Errorf("wrong DOT output:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestToDOTNodeCount(t *testing.T) {
+	count := 0
+	Inspect(walkTestProgram(), func(n Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+
+	dot := ToDOT(walkTestProgram())
+	if got := strings.Count(dot, "[label="); got != count {
+		t.Errorf("DOT has %d nodes, want %d", got, count)
+	}
+	if got := strings.Count(dot, " -> "); got != count-1 {
+		t.Errorf("DOT has %d edges, want %d", got, count-1)
+	}
+}
+
+func TestToTree(t *testing.T) {
+	expected := `Program
+  LetStatement
+    Identifier f
+    FunctionLiteral
+      Identifier a
+      BlockStatement
+        ExpressionStatement
+          IfExpression
+            InfixExpression >
+              Identifier a
+              IntegerLiteral 1
+            BlockStatement
+              ExpressionStatement
+                IndexExpression
+                  Identifier a
+                  IntegerLiteral 0
+            BlockStatement
+              ExpressionStatement
+                AssignExpression =
+                  MemberExpression
+                    Identifier h
+                    Identifier k
+                  HashLiteral
+                    StringLiteral "k"
+                    PrefixExpression -
+                      Identifier a
+  ForStatement
+    LetStatement
+      Identifier i
+      IntegerLiteral 0
+    InfixExpression <
+      Identifier i
+      IntegerLiteral 3
+    AssignExpression +=
+      Identifier i
+      IntegerLiteral 1
+    BlockStatement
+      BreakStatement
+  ForInStatement
+    Identifier x
+    Identifier f
+    BlockStatement
+      ContinueStatement
+`
+	if got := ToTree(walkTestProgram()); got != expected {
+		t.Errorf("wrong tree:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestToSExpr(t *testing.T) {
+	expected := `(let f (fn (a) (block (if (> a 1) (block (index a 0)) (block (= (. h k) (hash ("k" (- a)))))))))
+(for (let i 0) (< i 3) (+= i 1) (block (break)))
+(for-in x f (block (continue)))
+`
+	if got := ToSExpr(walkTestProgram()); got != expected {
+		t.Errorf("wrong s-expression:\n%s\nwant:\n%s", got, expected)
+	}
+
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&ForStatement{Body: &BlockStatement{}}, "(for () () () (block))"},
+		{&ReturnStatement{}, "(return)"},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{integer(1), &BooleanLiteral{Value: true}}}, "(call f 1 true)"},
+		{&ArrayLiteral{Elements: []Expression{}}, "(array)"},
+		{&IfExpression{Condition: ident("c"), Consequence: &BlockStatement{}}, "(if c (block))"},
+		{&FloatLiteral{Value: 2.5}, "2.5"},
+		{&BadExpression{}, "(bad-expression)"},
+	}
+
+	for _, tt := range tests {
+		if got := ToSExpr(tt.node); got != tt.expected {
+			t.Errorf("ToSExpr(%s) is %q, want %q", tt.node.String(), got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ========================= Graphviz ========================= //
+// ToDOT renders the tree under node as a Graphviz digraph, one box per node
+// labeled with its type and its operator or literal. Children are drawn left
+// to right in source order, e.g. `dot -Tsvg ast.dot > ast.svg`
+func ToDOT(node Node) string {
+	var out bytes.Buffer
+
+	out.WriteString("digraph AST {\n")
+	out.WriteString("\tordering=out;\n")
+	out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	Walk(&dotWriter{out: &out}, node)
+	out.WriteString("}\n")
+
+	return out.String()
+}
+
+// dotWriter numbers the nodes in visiting order, parents holds the ids of the
+// nodes Walk is inside of
+type dotWriter struct {
+	out     *bytes.Buffer
+	next    int
+	parents []int
+}
+
+func (w *dotWriter) Visit(node Node) Visitor {
+	if node == nil {
+		w.parents = w.parents[:len(w.parents)-1]
+		return nil
+	}
+
+	id := w.next
+	w.next++
+
+	fmt.Fprintf(w.out, "\tn%d [label=\"%s\"];\n", id, dotEscape(dotLabel(node)))
+	if len(w.parents) > 0 {
+		fmt.Fprintf(w.out, "\tn%d -> n%d;\n", w.parents[len(w.parents)-1], id)
+	}
+
+	w.parents = append(w.parents, id)
+	return w
+}
+
+// dotLabel is the node type, followed by what tells it apart from its siblings
+func dotLabel(node Node) string {
+	label := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+
+	var detail string
+	switch n := node.(type) {
+	case *Identifier:
+		detail = n.Value
+	case *IntegerLiteral:
+		detail = n.Token.Literal
+		if detail == "" {
+			detail = strconv.FormatInt(n.Value, 10)
+		}
+	case *FloatLiteral:
+		detail = n.Token.Literal
+		if detail == "" {
+			detail = strconv.FormatFloat(n.Value, 'g', -1, 64)
+		}
+	case *BooleanLiteral:
+		detail = strconv.FormatBool(n.Value)
+	case *StringLiteral:
+		detail = strconv.Quote(n.Value)
+	case *PrefixExpression:
+		detail = n.Operator
+	case *InfixExpression:
+		detail = n.Operator
+	case *AssignExpression:
+		detail = n.Operator
+	case *BadStatement:
+		detail = n.Token.Pos.String()
+	case *BadExpression:
+		detail = n.Token.Pos.String()
+	}
+
+	if detail == "" {
+		return label
+	}
+	return label + "\n" + detail
+}
+
+// dotEscape turns s into the content of a quoted DOT string
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
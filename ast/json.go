@@ -0,0 +1,470 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+)
+
+// ========================= JSON ========================= //
+// Every node is a JSON object whose "type" is the name of its Go type, e.g.
+//
+//	{"type": "Identifier", "token": {"type": "IDENT", "literal": "x", "pos": {...}}, "value": "x"}
+//
+// followed by its token (Program has none) and its fields in source order.
+// Missing children are null, Keys and Pairs of a HashLiteral are written as one
+// "pairs" list of {"key", "value"} objects
+
+// MarshalJSON encodes node and all its children
+func MarshalJSON(node Node) ([]byte, error) {
+	switch n := node.(type) {
+	case nil:
+		return []byte("null"), nil
+
+	// Statements
+	case *Program:
+		return writeObject("Program", field{"statements", statements(n.Statements)})
+	case *LetStatement:
+		return writeObject("LetStatement", field{"token", n.Token},
+			field{"name", jsonNode{n.Name}}, field{"value", jsonNode{n.Value}})
+	case *ReturnStatement:
+		return writeObject("ReturnStatement", field{"token", n.Token},
+			field{"returnValue", jsonNode{n.ReturnValue}})
+	case *ExpressionStatement:
+		return writeObject("ExpressionStatement", field{"token", n.Token},
+			field{"expression", jsonNode{n.Expression}})
+	case *BlockStatement:
+		// a nil *BlockStatement or *Identifier child is not a nil Node
+		if n == nil {
+			return []byte("null"), nil
+		}
+		return writeObject("BlockStatement", field{"token", n.Token},
+			field{"statements", statements(n.Statements)})
+	case *WhileStatement:
+		return writeObject("WhileStatement", field{"token", n.Token},
+			field{"condition", jsonNode{n.Condition}}, field{"body", jsonNode{n.Body}})
+	case *ForStatement:
+		return writeObject("ForStatement", field{"token", n.Token},
+			field{"init", jsonNode{n.Init}}, field{"condition", jsonNode{n.Condition}},
+			field{"update", jsonNode{n.Update}}, field{"body", jsonNode{n.Body}})
+	case *ForInStatement:
+		return writeObject("ForInStatement", field{"token", n.Token},
+			field{"variable", jsonNode{n.Variable}}, field{"iterable", jsonNode{n.Iterable}},
+			field{"body", jsonNode{n.Body}})
+	case *BreakStatement:
+		return writeObject("BreakStatement", field{"token", n.Token})
+	case *ContinueStatement:
+		return writeObject("ContinueStatement", field{"token", n.Token})
+	case *BadStatement:
+		return writeObject("BadStatement", field{"token", n.Token}, field{"end", n.End})
+
+	// Expressions
+	case *Identifier:
+		if n == nil {
+			return []byte("null"), nil
+		}
+		return writeObject("Identifier", field{"token", n.Token}, field{"value", n.Value})
+	case *IntegerLiteral:
+		return writeObject("IntegerLiteral", field{"token", n.Token}, field{"value", n.Value})
+	case *FloatLiteral:
+		return writeObject("FloatLiteral", field{"token", n.Token}, field{"value", n.Value})
+	case *BooleanLiteral:
+		return writeObject("BooleanLiteral", field{"token", n.Token}, field{"value", n.Value})
+	case *StringLiteral:
+		return writeObject("StringLiteral", field{"token", n.Token}, field{"value", n.Value})
+	case *ArrayLiteral:
+		return writeObject("ArrayLiteral", field{"token", n.Token},
+			field{"elements", expressions(n.Elements)})
+	case *HashLiteral:
+		pairs := make([]jsonPair, 0, len(n.Keys))
+		for _, key := range n.Keys {
+			pairs = append(pairs, jsonPair{jsonNode{key}, jsonNode{n.Pairs[key]}})
+		}
+		return writeObject("HashLiteral", field{"token", n.Token}, field{"pairs", pairs})
+	case *FunctionLiteral:
+		var params []jsonNode
+		if n.Parameters != nil {
+			params = make([]jsonNode, 0, len(n.Parameters))
+			for _, param := range n.Parameters {
+				params = append(params, jsonNode{param})
+			}
+		}
+		return writeObject("FunctionLiteral", field{"token", n.Token},
+			field{"parameters", params}, field{"body", jsonNode{n.Body}})
+	case *PrefixExpression:
+		return writeObject("PrefixExpression", field{"token", n.Token},
+			field{"operator", n.Operator}, field{"right", jsonNode{n.Right}})
+	case *InfixExpression:
+		return writeObject("InfixExpression", field{"token", n.Token},
+			field{"left", jsonNode{n.Left}}, field{"operator", n.Operator}, field{"right", jsonNode{n.Right}})
+	case *IfExpression:
+		return writeObject("IfExpression", field{"token", n.Token},
+			field{"condition", jsonNode{n.Condition}}, field{"consequence", jsonNode{n.Consequence}},
+			field{"alternative", jsonNode{n.Alternative}})
+	case *CallExpression:
+		return writeObject("CallExpression", field{"token", n.Token},
+			field{"function", jsonNode{n.Function}}, field{"arguments", expressions(n.Arguments)})
+	case *IndexExpression:
+		return writeObject("IndexExpression", field{"token", n.Token},
+			field{"left", jsonNode{n.Left}}, field{"index", jsonNode{n.Index}})
+	case *MemberExpression:
+		return writeObject("MemberExpression", field{"token", n.Token},
+			field{"object", jsonNode{n.Object}}, field{"property", jsonNode{n.Property}})
+	case *AssignExpression:
+		return writeObject("AssignExpression", field{"token", n.Token},
+			field{"target", jsonNode{n.Target}}, field{"operator", n.Operator}, field{"value", jsonNode{n.Value}})
+	case *BadExpression:
+		return writeObject("BadExpression", field{"token", n.Token})
+	}
+
+	return nil, fmt.Errorf("ast: cannot marshal node type %T", node)
+}
+
+// jsonNode lets encoding/json marshal a child node with MarshalJSON
+type jsonNode struct {
+	Node Node
+}
+
+func (j jsonNode) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(j.Node)
+}
+
+type jsonPair struct {
+	Key   jsonNode `json:"key"`
+	Value jsonNode `json:"value"`
+}
+
+// nil lists stay null, empty lists stay []
+func statements(list []Statement) []jsonNode {
+	if list == nil {
+		return nil
+	}
+	nodes := make([]jsonNode, 0, len(list))
+	for _, stmt := range list {
+		nodes = append(nodes, jsonNode{stmt})
+	}
+	return nodes
+}
+
+func expressions(list []Expression) []jsonNode {
+	if list == nil {
+		return nil
+	}
+	nodes := make([]jsonNode, 0, len(list))
+	for _, exp := range list {
+		nodes = append(nodes, jsonNode{exp})
+	}
+	return nodes
+}
+
+type field struct {
+	name  string
+	value interface{}
+}
+
+// writeObject writes {"type": typ, fields...} keeping the order of the fields
+func writeObject(typ string, fields ...field) ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString(`{"type":`)
+	name, _ := json.Marshal(typ)
+	out.Write(name)
+
+	for _, f := range fields {
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(`,"` + f.name + `":`)
+		out.Write(value)
+	}
+
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a node written by MarshalJSON, null gives a nil Node
+func UnmarshalJSON(data []byte) (Node, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ast: %v", err)
+	}
+
+	var typ string
+	if err := json.Unmarshal(fields["type"], &typ); err != nil {
+		return nil, fmt.Errorf("ast: node without a type: %s", data)
+	}
+
+	d := &decoder{typ: typ, fields: fields}
+	var tok token.Token
+	if typ != "Program" {
+		d.value("token", &tok)
+	}
+
+	var node Node
+	switch typ {
+	// Statements
+	case "Program":
+		node = &Program{Statements: d.statements("statements")}
+	case "LetStatement":
+		node = &LetStatement{Token: tok, Name: d.identifier("name"), Value: d.expression("value")}
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: tok, ReturnValue: d.expression("returnValue")}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: tok, Expression: d.expression("expression")}
+	case "BlockStatement":
+		node = &BlockStatement{Token: tok, Statements: d.statements("statements")}
+	case "WhileStatement":
+		node = &WhileStatement{Token: tok, Condition: d.expression("condition"), Body: d.block("body")}
+	case "ForStatement":
+		node = &ForStatement{
+			Token:     tok,
+			Init:      d.statement("init"),
+			Condition: d.expression("condition"),
+			Update:    d.expression("update"),
+			Body:      d.block("body"),
+		}
+	case "ForInStatement":
+		node = &ForInStatement{
+			Token:    tok,
+			Variable: d.identifier("variable"),
+			Iterable: d.expression("iterable"),
+			Body:     d.block("body"),
+		}
+	case "BreakStatement":
+		node = &BreakStatement{Token: tok}
+	case "ContinueStatement":
+		node = &ContinueStatement{Token: tok}
+	case "BadStatement":
+		bad := &BadStatement{Token: tok}
+		d.value("end", &bad.End)
+		node = bad
+
+	// Expressions
+	case "Identifier":
+		ident := &Identifier{Token: tok}
+		d.value("value", &ident.Value)
+		node = ident
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "FloatLiteral":
+		lit := &FloatLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "BooleanLiteral":
+		lit := &BooleanLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "StringLiteral":
+		lit := &StringLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "ArrayLiteral":
+		node = &ArrayLiteral{Token: tok, Elements: d.expressions("elements")}
+	case "HashLiteral":
+		node = d.hash(tok)
+	case "FunctionLiteral":
+		node = &FunctionLiteral{Token: tok, Parameters: d.identifiers("parameters"), Body: d.block("body")}
+	case "PrefixExpression":
+		prefix := &PrefixExpression{Token: tok, Right: d.expression("right")}
+		d.value("operator", &prefix.Operator)
+		node = prefix
+	case "InfixExpression":
+		infix := &InfixExpression{Token: tok, Left: d.expression("left"), Right: d.expression("right")}
+		d.value("operator", &infix.Operator)
+		node = infix
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       tok,
+			Condition:   d.expression("condition"),
+			Consequence: d.block("consequence"),
+			Alternative: d.block("alternative"),
+		}
+	case "CallExpression":
+		node = &CallExpression{Token: tok, Function: d.expression("function"), Arguments: d.expressions("arguments")}
+	case "IndexExpression":
+		node = &IndexExpression{Token: tok, Left: d.expression("left"), Index: d.expression("index")}
+	case "MemberExpression":
+		node = &MemberExpression{Token: tok, Object: d.expression("object"), Property: d.identifier("property")}
+	case "AssignExpression":
+		assign := &AssignExpression{Token: tok, Target: d.expression("target"), Value: d.expression("value")}
+		d.value("operator", &assign.Operator)
+		node = assign
+	case "BadExpression":
+		node = &BadExpression{Token: tok}
+	default:
+		return nil, fmt.Errorf("ast: unknown node type %q", typ)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// decoder reads the fields of one node, the first error is kept in err
+type decoder struct {
+	typ    string
+	fields map[string]json.RawMessage
+	err    error
+}
+
+func (d *decoder) fail(name string, err error) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: %s.%s: %v", d.typ, name, err)
+	}
+}
+
+// value decodes a plain field, a missing field leaves v unchanged
+func (d *decoder) value(name string, v interface{}) {
+	data, ok := d.fields[name]
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail(name, err)
+	}
+}
+
+func (d *decoder) node(data json.RawMessage) Node {
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		// 子节点的错误已经带了位置信息
+		if d.err == nil {
+			d.err = err
+		}
+		return nil
+	}
+	return node
+}
+
+func (d *decoder) expression(name string) Expression {
+	return d.toExpression(name, d.node(d.fields[name]))
+}
+
+func (d *decoder) toExpression(name string, node Node) Expression {
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		d.fail(name, fmt.Errorf("%T is not an expression", node))
+	}
+	return exp
+}
+
+func (d *decoder) statement(name string) Statement {
+	node := d.node(d.fields[name])
+	if node == nil {
+		return nil
+	}
+	stmt, ok := node.(Statement)
+	if !ok {
+		d.fail(name, fmt.Errorf("%T is not a statement", node))
+	}
+	return stmt
+}
+
+func (d *decoder) block(name string) *BlockStatement {
+	node := d.node(d.fields[name])
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail(name, fmt.Errorf("%T is not a block", node))
+	}
+	return block
+}
+
+func (d *decoder) identifier(name string) *Identifier {
+	return d.toIdentifier(name, d.node(d.fields[name]))
+}
+
+func (d *decoder) toIdentifier(name string, node Node) *Identifier {
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail(name, fmt.Errorf("%T is not an identifier", node))
+	}
+	return ident
+}
+
+// list returns the raw elements of a list field, nil for null
+func (d *decoder) list(name string) []json.RawMessage {
+	var list []json.RawMessage
+	d.value(name, &list)
+	return list
+}
+
+func (d *decoder) statements(name string) []Statement {
+	raw := d.list(name)
+	if raw == nil {
+		return nil
+	}
+	list := make([]Statement, 0, len(raw))
+	for _, data := range raw {
+		node := d.node(data)
+		stmt, ok := node.(Statement)
+		if !ok {
+			d.fail(name, fmt.Errorf("%T is not a statement", node))
+		}
+		list = append(list, stmt)
+	}
+	return list
+}
+
+func (d *decoder) expressions(name string) []Expression {
+	raw := d.list(name)
+	if raw == nil {
+		return nil
+	}
+	list := make([]Expression, 0, len(raw))
+	for _, data := range raw {
+		list = append(list, d.toExpression(name, d.node(data)))
+	}
+	return list
+}
+
+func (d *decoder) identifiers(name string) IdentifierList {
+	raw := d.list(name)
+	if raw == nil {
+		return nil
+	}
+	list := make(IdentifierList, 0, len(raw))
+	for _, data := range raw {
+		list = append(list, d.toIdentifier(name, d.node(data)))
+	}
+	return list
+}
+
+func (d *decoder) hash(tok token.Token) *HashLiteral {
+	var pairs []struct {
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	d.value("pairs", &pairs)
+
+	hash := &HashLiteral{Token: tok, Pairs: make(map[Expression]Expression), Keys: []Expression{}}
+	for _, pair := range pairs {
+		key := d.toExpression("pairs", d.node(pair.Key))
+		hash.Pairs[key] = d.toExpression("pairs", d.node(pair.Value))
+		hash.Keys = append(hash.Keys, key)
+	}
+	return hash
+}
+
+// isNull reports a null or missing value
+func isNull(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) == 0 || bytes.Equal(data, []byte("null"))
+}
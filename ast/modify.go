@@ -0,0 +1,154 @@
+package ast
+
+import "fmt"
+
+// ========================= 改写 ========================= //
+// Modify rewrites an AST bottom-up: the children of node are modified first,
+// then fn is called on node itself and its result replaces node. fn returns
+// its argument to leave a node untouched, so untouched nodes keep their token.
+//
+// The tree is changed in place. A replacement must fit the slot it goes in:
+// an Expression for an Expression, a *BlockStatement for a block, and so on,
+// otherwise Modify panics. Nil children are not passed to fn
+func Modify(node Node, fn func(Node) Node) Node {
+	switch n := node.(type) {
+	// Statements
+	case *Program:
+		modifyStatements(n.Statements, fn)
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, fn)
+		n.Value = modifyExpression(n.Value, fn)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, fn)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, fn)
+	case *BlockStatement:
+		modifyStatements(n.Statements, fn)
+	case *WhileStatement:
+		n.Condition = modifyExpression(n.Condition, fn)
+		n.Body = modifyBlock(n.Body, fn)
+	case *ForStatement:
+		n.Init = modifyStatement(n.Init, fn)
+		n.Condition = modifyExpression(n.Condition, fn)
+		n.Update = modifyExpression(n.Update, fn)
+		n.Body = modifyBlock(n.Body, fn)
+	case *ForInStatement:
+		n.Variable = modifyIdentifier(n.Variable, fn)
+		n.Iterable = modifyExpression(n.Iterable, fn)
+		n.Body = modifyBlock(n.Body, fn)
+	case *BreakStatement, *ContinueStatement, *BadStatement:
+		// no children
+
+	// Expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *BooleanLiteral, *StringLiteral, *BadExpression:
+		// no children
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, fn)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, fn)
+		n.Right = modifyExpression(n.Right, fn)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, fn)
+		n.Consequence = modifyBlock(n.Consequence, fn)
+		n.Alternative = modifyBlock(n.Alternative, fn)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = modifyIdentifier(param, fn)
+		}
+		n.Body = modifyBlock(n.Body, fn)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, fn)
+		modifyExpressions(n.Arguments, fn)
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, fn)
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, fn)
+		n.Index = modifyExpression(n.Index, fn)
+	case *HashLiteral:
+		// key变了之后map要重建，Keys和Pairs必须保持一致
+		pairs := make(map[Expression]Expression, len(n.Keys))
+		for i, key := range n.Keys {
+			value := n.Pairs[key]
+			key = modifyExpression(key, fn)
+			pairs[key] = modifyExpression(value, fn)
+			n.Keys[i] = key
+		}
+		n.Pairs = pairs
+	case *MemberExpression:
+		n.Object = modifyExpression(n.Object, fn)
+		n.Property = modifyIdentifier(n.Property, fn)
+	case *AssignExpression:
+		n.Target = modifyExpression(n.Target, fn)
+		n.Value = modifyExpression(n.Value, fn)
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return fn(node)
+}
+
+func modifyStatements(list []Statement, fn func(Node) Node) {
+	for i, stmt := range list {
+		list[i] = modifyStatement(stmt, fn)
+	}
+}
+
+func modifyExpressions(list []Expression, fn func(Node) Node) {
+	for i, exp := range list {
+		list[i] = modifyExpression(exp, fn)
+	}
+}
+
+func modifyStatement(stmt Statement, fn func(Node) Node) Statement {
+	if stmt == nil {
+		return nil
+	}
+
+	newNode := Modify(stmt, fn)
+	result, ok := newNode.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: statement %T replaced by %T", stmt, newNode))
+	}
+	return result
+}
+
+func modifyExpression(exp Expression, fn func(Node) Node) Expression {
+	if exp == nil {
+		return nil
+	}
+
+	newNode := Modify(exp, fn)
+	result, ok := newNode.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: expression %T replaced by %T", exp, newNode))
+	}
+	return result
+}
+
+func modifyBlock(block *BlockStatement, fn func(Node) Node) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	newNode := Modify(block, fn)
+	result, ok := newNode.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: block replaced by %T", newNode))
+	}
+	return result
+}
+
+// names (let, parameters, for-in variable, member property) must stay identifiers
+func modifyIdentifier(ident *Identifier, fn func(Node) Node) *Identifier {
+	if ident == nil {
+		return nil
+	}
+
+	newNode := Modify(ident, fn)
+	result, ok := newNode.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: identifier %s replaced by %T", ident.Value, newNode))
+	}
+	return result
+}
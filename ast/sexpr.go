@@ -0,0 +1,151 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// ========================= S-expression ========================= //
+// ToSExpr renders node in a Lisp style where every operator comes first and
+// every parenthesis is written, which shows how the parser grouped the
+// operands: "1 + 2 * 3" is (+ 1 (* 2 3)). The statements of a program are
+// written one per line
+func ToSExpr(node Node) string {
+	var out bytes.Buffer
+	writeSExpr(&out, node)
+	return out.String()
+}
+
+func writeSExpr(out *bytes.Buffer, node Node) {
+	switch n := node.(type) {
+	// Statements
+	case *Program:
+		for _, s := range n.Statements {
+			writeSExpr(out, s)
+			out.WriteString("\n")
+		}
+	case *LetStatement:
+		writeList(out, "let", n.Name, n.Value)
+	case *ReturnStatement:
+		if n.ReturnValue == nil {
+			writeList(out, "return")
+		} else {
+			writeList(out, "return", n.ReturnValue)
+		}
+	case *ExpressionStatement:
+		writeSExpr(out, n.Expression)
+	case *BlockStatement:
+		if n == nil {
+			out.WriteString("()")
+			return
+		}
+		nodes := make([]Node, 0, len(n.Statements))
+		for _, s := range n.Statements {
+			nodes = append(nodes, s)
+		}
+		writeList(out, "block", nodes...)
+	case *WhileStatement:
+		writeList(out, "while", n.Condition, n.Body)
+	case *ForStatement:
+		writeList(out, "for", n.Init, n.Condition, n.Update, n.Body)
+	case *ForInStatement:
+		writeList(out, "for-in", n.Variable, n.Iterable, n.Body)
+	case *BreakStatement:
+		writeList(out, "break")
+	case *ContinueStatement:
+		writeList(out, "continue")
+	case *BadStatement:
+		writeList(out, "bad-statement")
+
+	// Expressions
+	case *Identifier:
+		if n == nil {
+			out.WriteString("()")
+			return
+		}
+		out.WriteString(n.Value)
+	case *IntegerLiteral:
+		out.WriteString(n.Token.Literal)
+		if n.Token.Literal == "" {
+			out.WriteString(strconv.FormatInt(n.Value, 10))
+		}
+	case *FloatLiteral:
+		out.WriteString(n.Token.Literal)
+		if n.Token.Literal == "" {
+			out.WriteString(strconv.FormatFloat(n.Value, 'g', -1, 64))
+		}
+	case *BooleanLiteral:
+		out.WriteString(strconv.FormatBool(n.Value))
+	case *StringLiteral:
+		out.WriteString(strconv.Quote(n.Value))
+	case *PrefixExpression:
+		writeList(out, n.Operator, n.Right)
+	case *InfixExpression:
+		writeList(out, n.Operator, n.Left, n.Right)
+	case *AssignExpression:
+		writeList(out, n.Operator, n.Target, n.Value)
+	case *IfExpression:
+		if n.Alternative == nil {
+			writeList(out, "if", n.Condition, n.Consequence)
+		} else {
+			writeList(out, "if", n.Condition, n.Consequence, n.Alternative)
+		}
+	case *FunctionLiteral:
+		out.WriteString("(fn (")
+		for i, p := range n.Parameters {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			writeSExpr(out, p)
+		}
+		out.WriteString(") ")
+		writeSExpr(out, n.Body)
+		out.WriteString(")")
+	case *CallExpression:
+		writeList(out, "call", append([]Node{n.Function}, expressionNodes(n.Arguments)...)...)
+	case *ArrayLiteral:
+		writeList(out, "array", expressionNodes(n.Elements)...)
+	case *IndexExpression:
+		writeList(out, "index", n.Left, n.Index)
+	case *MemberExpression:
+		writeList(out, ".", n.Object, n.Property)
+	case *HashLiteral:
+		out.WriteString("(hash")
+		for _, key := range n.Keys {
+			out.WriteString(" (")
+			writeSExpr(out, key)
+			out.WriteString(" ")
+			writeSExpr(out, n.Pairs[key])
+			out.WriteString(")")
+		}
+		out.WriteString(")")
+	case *BadExpression:
+		writeList(out, "bad-expression")
+
+	case nil:
+		// 空的for子句
+		out.WriteString("()")
+	default:
+		panic(fmt.Sprintf("ast.ToSExpr: unexpected node type %T", n))
+	}
+}
+
+// writeList writes (head item...), a nil item is written as ()
+func writeList(out *bytes.Buffer, head string, items ...Node) {
+	out.WriteString("(")
+	out.WriteString(head)
+	for _, item := range items {
+		out.WriteString(" ")
+		writeSExpr(out, item)
+	}
+	out.WriteString(")")
+}
+
+func expressionNodes(list []Expression) []Node {
+	nodes := make([]Node, 0, len(list))
+	for _, e := range list {
+		nodes = append(nodes, e)
+	}
+	return nodes
+}
@@ -0,0 +1,41 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ========================= 缩进的树 ========================= //
+// ToTree renders the tree under node one node per line, children indented by
+// two spaces under their parent, e.g. for "let x = 1 + 2;"
+//
+//	Program
+//	  LetStatement
+//	    Identifier x
+//	    InfixExpression +
+//	      IntegerLiteral 1
+//	      IntegerLiteral 2
+func ToTree(node Node) string {
+	var out bytes.Buffer
+	Walk(&treeWriter{out: &out}, node)
+	return out.String()
+}
+
+type treeWriter struct {
+	out   *bytes.Buffer
+	depth int
+}
+
+func (w *treeWriter) Visit(node Node) Visitor {
+	if node == nil {
+		w.depth--
+		return nil
+	}
+
+	w.out.WriteString(strings.Repeat("  ", w.depth))
+	w.out.WriteString(strings.ReplaceAll(dotLabel(node), "\n", " "))
+	w.out.WriteString("\n")
+
+	w.depth++
+	return w
+}
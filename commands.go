@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"sort"
+)
+
+// ===================== 命令行子命令 ================
+// a command gets the arguments after its name and returns the exit status
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+const (
+	astUsage = "monkey ast [--json | --dot] [-o file] file.mk"
+	fmtUsage = "monkey fmt [-w] [file.mk ...]"
+)
+
+var commands = map[string]command{
+	"ast": {runAST, astUsage},
+	"fmt": {runFmt, fmtUsage},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	fmt.Fprintln(w, "  monkey    (start the REPL)")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+// parseFile parses a source file, comments are kept on the tokens. The
+// diagnostics are printed to stderr
+func parseFile(filename string) (*ast.Program, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	defer f.Close()
+
+	l := lexer.NewFileReader(filename, f)
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) != 0 {
+		fmt.Fprint(os.Stderr, errors.Text())
+		return nil, false
+	}
+	return program, true
+}
+
+// runAST prints the AST of a file, as JSON with --json or as a Graphviz graph
+// with --dot, into the file given by -o
+func runAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the AST as JSON")
+	asDOT := flags.Bool("dot", false, "print the AST as a Graphviz DOT graph")
+	output := flags.String("o", "", "write to `file` instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s\n", astUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*asJSON && *asDOT) {
+		flags.Usage()
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	var out bytes.Buffer
+	switch {
+	case *asJSON:
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := json.Indent(&out, data, "", "  "); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out.WriteString("\n")
+	case *asDOT:
+		out.WriteString(ast.ToDOT(program))
+	default:
+		out.WriteString(program.String())
+		out.WriteString("\n")
+	}
+
+	if *output == "" {
+		out.WriteTo(os.Stdout)
+		return 0
+	}
+	if err := os.WriteFile(*output, out.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runFmt formats files to stdout, or in place with -w. Without files it
+// formats stdin
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s\n", fmtUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "cannot use -w with stdin")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return formatSource("<stdin>", src, false)
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if s := formatSource(filename, src, *write); s != 0 {
+			status = s
+		}
+	}
+	return status
+}
+
+// formatSource only rewrites a file when its content changes
+func formatSource(filename string, src []byte, write bool) int {
+	res, err := format.Source(src)
+	if err != nil {
+		if errors, ok := err.(parser.ErrorList); ok {
+			for _, d := range errors {
+				d.Span.Start.Filename = filename
+				fmt.Fprintln(os.Stderr, d)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		}
+		return 1
+	}
+
+	if !write {
+		os.Stdout.Write(res)
+		return 0
+	}
+	if bytes.Equal(src, res) {
+		return 0
+	}
+	// 保留原来的权限，比如可执行的脚本
+	info, err := os.Stat(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
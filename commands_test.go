@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"monkey/ast"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile puts content in a temporary directory and returns its path
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// quiet drops what the commands print to stderr until the test ends
+func quiet(t *testing.T) {
+	t.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stderr := os.Stderr
+	os.Stderr = devNull
+	t.Cleanup(func() {
+		os.Stderr = stderr
+		devNull.Close()
+	})
+}
+
+func TestAST(t *testing.T) {
+	src := writeFile(t, "main.mk", "let x = 1 + 2 * 3;\n")
+
+	tests := []struct {
+		flags []string
+		check func(t *testing.T, out string)
+	}{
+		{nil, func(t *testing.T, out string) {
+			if out != "let x = (1 + (2 * 3));\n" {
+				t.Errorf("printed %q", out)
+			}
+		}},
+		{[]string{"--json"}, func(t *testing.T, out string) {
+			node, err := ast.UnmarshalJSON([]byte(out))
+			if err != nil {
+				t.Fatalf("UnmarshalJSON: %v", err)
+			}
+			if node.String() != "let x = (1 + (2 * 3));" {
+				t.Errorf("decoded %q", node.String())
+			}
+			// 缩进过的json
+			if !json.Valid([]byte(out)) || !strings.Contains(out, "\n  \"statements\": [") {
+				t.Errorf("printed %q", out)
+			}
+		}},
+		{[]string{"--dot"}, func(t *testing.T, out string) {
+			if !strings.HasPrefix(out, "digraph") || !strings.Contains(out, "LetStatement") {
+				t.Errorf("printed %q", out)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		output := filepath.Join(t.TempDir(), "out")
+		args := append(append([]string{}, tt.flags...), "-o", output, src)
+
+		if status := runAST(args); status != 0 {
+			t.Fatalf("monkey ast %s exited with %d", strings.Join(args, " "), status)
+		}
+		tt.check(t, readFile(t, output))
+	}
+}
+
+func TestASTErrors(t *testing.T) {
+	broken := writeFile(t, "broken.mk", "let = 1;\n")
+
+	tests := []struct {
+		args   []string
+		status int
+	}{
+		{[]string{"--json", "--dot", broken}, 2},
+		{[]string{}, 2},
+		{[]string{"--bad", broken}, 2},
+		{[]string{broken}, 1},
+		{[]string{filepath.Join(t.TempDir(), "missing.mk")}, 1},
+	}
+
+	quiet(t)
+
+	for _, tt := range tests {
+		if status := runAST(tt.args); status != tt.status {
+			t.Errorf("monkey ast %s exited with %d, want %d", strings.Join(tt.args, " "), status, tt.status)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	ugly := writeFile(t, "ugly.mk", "let x=007\n// keep me\nlet f=fn(a,b){a+b}")
+	script := writeFile(t, "script.mk", "let z=2")
+	if err := os.Chmod(script, 0700); err != nil {
+		t.Fatal(err)
+	}
+	clean := writeFile(t, "clean.mk", "let y = 1;\n")
+	info, _ := os.Stat(clean)
+
+	if status := runFmt([]string{"-w", ugly, clean, script}); status != 0 {
+		t.Fatalf("monkey fmt -w exited with %d", status)
+	}
+
+	expected := "let x = 007;\n// keep me\nlet f = fn(a, b) {\n    a + b;\n};\n"
+	if got := readFile(t, ugly); got != expected {
+		t.Errorf("formatted to\n%s\nwant\n%s", got, expected)
+	}
+
+	// 重写的文件保留原来的权限
+	if after, _ := os.Stat(script); after.Mode().Perm() != 0700 || readFile(t, script) != "let z = 2;\n" {
+		t.Errorf("script.mk is %v %q", after.Mode().Perm(), readFile(t, script))
+	}
+
+	// 已经格式化的文件不重写
+	if after, _ := os.Stat(clean); !after.ModTime().Equal(info.ModTime()) || readFile(t, clean) != "let y = 1;\n" {
+		t.Errorf("clean.mk was rewritten")
+	}
+}
+
+func TestFmtErrors(t *testing.T) {
+	broken := writeFile(t, "broken.mk", "let = 1;\n")
+
+	quiet(t)
+
+	if status := runFmt([]string{"-w", broken}); status != 1 {
+		t.Errorf("monkey fmt -w broken.mk exited with %d, want 1", status)
+	}
+	if readFile(t, broken) != "let = 1;\n" {
+		t.Errorf("broken.mk was rewritten")
+	}
+	if status := runFmt([]string{"-w"}); status != 2 {
+		t.Errorf("monkey fmt -w exited with %d, want 2", status)
+	}
+}
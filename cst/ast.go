@@ -0,0 +1,202 @@
+package cst
+
+import (
+	"monkey/ast"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+// ========================= projection ========================= //
+// ToAST projects the tree into the ast.Program that parser.New gives for the
+// same source in lexer.ScanComments mode: for a valid program the two are
+// identical, tokens, positions and comments included. A BadStatement or a
+// BadExpression node becomes an ast.BadStatement or an ast.BadExpression
+func ToAST(root *Node) *ast.Program {
+	c := &converter{root: root}
+	return &ast.Program{Statements: c.statements(root.Nodes())}
+}
+
+type converter struct {
+	root *Node
+}
+
+// first is the first token of n, for an empty node the token after it
+func (c *converter) first(n *Node) token.Token {
+	if t := n.FirstToken(); t != nil {
+		return t.Token()
+	}
+	return c.root.TokenAt(n.Offset()).Token()
+}
+
+// ===================== statement ================
+func (c *converter) statements(nodes []*Node) []ast.Statement {
+	statements := []ast.Statement{}
+	for _, n := range nodes {
+		statements = append(statements, c.statement(n))
+	}
+	return statements
+}
+
+func (c *converter) badStatement(n *Node) *ast.BadStatement {
+	bad := &ast.BadStatement{Token: c.first(n)}
+	bad.End = bad.Token.Pos
+	if t := n.LastToken(); t != nil {
+		bad.End = t.Pos()
+	}
+	return bad
+}
+
+func (c *converter) statement(n *Node) ast.Statement {
+	tok := c.first(n)
+	nodes := n.Nodes()
+
+	switch n.Kind() {
+	case LetStatement:
+		return &ast.LetStatement{Token: tok, Name: c.identifier(nodes[0]), Value: c.expression(nodes[1])}
+	case ReturnStatement:
+		stmt := &ast.ReturnStatement{Token: tok}
+		if len(nodes) > 0 {
+			stmt.ReturnValue = c.expression(nodes[0])
+		}
+		return stmt
+	case ExpressionStatement:
+		return &ast.ExpressionStatement{Token: tok, Expression: c.expression(nodes[0])}
+	case WhileStatement:
+		return &ast.WhileStatement{Token: tok, Condition: c.expression(nodes[0]), Body: c.block(nodes[1])}
+	case ForStatement:
+		return c.forStatement(n)
+	case ForInStatement:
+		return &ast.ForInStatement{Token: tok, Variable: c.identifier(nodes[0]),
+			Iterable: c.expression(nodes[1]), Body: c.block(nodes[2])}
+	case BreakStatement:
+		return &ast.BreakStatement{Token: tok}
+	case ContinueStatement:
+		return &ast.ContinueStatement{Token: tok}
+	}
+
+	return c.badStatement(n)
+}
+
+// the three parts of the header are optional, count the ';' to tell them apart.
+// the init is a statement that holds its own ';'
+func (c *converter) forStatement(n *Node) ast.Statement {
+	stmt := &ast.ForStatement{Token: c.first(n)}
+	part := 0
+
+	for _, child := range n.Children() {
+		switch child := child.(type) {
+		case *Token:
+			if child.Is(token.SEMICOLON) {
+				part++
+			}
+		case *Node:
+			switch {
+			case child.Kind() == BlockStatement:
+				stmt.Body = c.block(child)
+			case part == 0:
+				stmt.Init = c.statement(child)
+				part++
+			case part == 1:
+				stmt.Condition = c.expression(child)
+			default:
+				stmt.Update = c.expression(child)
+			}
+		}
+	}
+
+	return stmt
+}
+
+func (c *converter) block(n *Node) *ast.BlockStatement {
+	return &ast.BlockStatement{Token: c.first(n), Statements: c.statements(n.Nodes())}
+}
+
+func (c *converter) identifier(n *Node) *ast.Identifier {
+	tok := c.first(n)
+	return &ast.Identifier{Token: tok, Value: tok.Literal}
+}
+
+// ===================== expression ================
+func (c *converter) expression(n *Node) ast.Expression {
+	tok := c.first(n)
+
+	nodes := n.Nodes()
+	tokens := n.Tokens()
+
+	switch n.Kind() {
+	case Identifier:
+		return c.identifier(n)
+	case IntegerLiteral:
+		value, err := parser.IntegerValue(tok.Literal)
+		if err != nil {
+			return &ast.BadExpression{Token: tok}
+		}
+		return &ast.IntegerLiteral{Token: tok, Value: value}
+	case FloatLiteral:
+		value, err := strconv.ParseFloat(strings.ReplaceAll(tok.Literal, "_", ""), 64)
+		if err != nil {
+			return &ast.BadExpression{Token: tok}
+		}
+		return &ast.FloatLiteral{Token: tok, Value: value}
+	case BooleanLiteral:
+		return &ast.BooleanLiteral{Token: tok, Value: tok.Type == token.TRUE}
+	case StringLiteral:
+		return &ast.StringLiteral{Token: tok, Value: tok.Literal}
+	case ParenExpression:
+		return c.expression(nodes[0])
+	case PrefixExpression:
+		return &ast.PrefixExpression{Token: tok, Operator: tok.Literal, Right: c.expression(nodes[0])}
+	case InfixExpression:
+		op := tokens[0].Token()
+		return &ast.InfixExpression{Token: op, Left: c.expression(nodes[0]), Operator: op.Literal,
+			Right: c.expression(nodes[1])}
+	case AssignExpression:
+		op := tokens[0].Token()
+		return &ast.AssignExpression{Token: op, Target: c.expression(nodes[0]), Operator: op.Literal,
+			Value: c.expression(nodes[1])}
+	case IfExpression:
+		exp := &ast.IfExpression{Token: tok, Condition: c.expression(nodes[0]), Consequence: c.block(nodes[1])}
+		if len(nodes) > 2 {
+			exp.Alternative = c.block(nodes[2])
+		}
+		return exp
+	case FunctionLiteral:
+		params := ast.IdentifierList{}
+		for _, p := range nodes[0].Nodes() {
+			params = append(params, c.identifier(p))
+		}
+		return &ast.FunctionLiteral{Token: tok, Parameters: params, Body: c.block(nodes[1])}
+	case CallExpression:
+		return &ast.CallExpression{Token: c.first(nodes[1]), Function: c.expression(nodes[0]),
+			Arguments: c.expressions(nodes[1].Nodes())}
+	case ArrayLiteral:
+		return &ast.ArrayLiteral{Token: tok, Elements: c.expressions(nodes)}
+	case IndexExpression:
+		return &ast.IndexExpression{Token: tokens[0].Token(), Left: c.expression(nodes[0]),
+			Index: c.expression(nodes[1])}
+	case MemberExpression:
+		return &ast.MemberExpression{Token: tokens[0].Token(), Object: c.expression(nodes[0]),
+			Property: c.identifier(nodes[1])}
+	case HashLiteral:
+		hash := &ast.HashLiteral{Token: tok, Pairs: map[ast.Expression]ast.Expression{}, Keys: []ast.Expression{}}
+		for _, pair := range nodes {
+			kv := pair.Nodes()
+			key := c.expression(kv[0])
+			hash.Pairs[key] = c.expression(kv[1])
+			hash.Keys = append(hash.Keys, key)
+		}
+		return hash
+	}
+
+	return &ast.BadExpression{Token: tok}
+}
+
+func (c *converter) expressions(nodes []*Node) []ast.Expression {
+	list := []ast.Expression{}
+	for _, n := range nodes {
+		list = append(list, c.expression(n))
+	}
+	return list
+}
@@ -0,0 +1,247 @@
+package cst
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// corpus returns the string literals of the lexer, parser and evaluator
+// tests, valid programs and broken ones
+func corpus(t *testing.T) []string {
+	var inputs []string
+
+	for _, filename := range []string{"../lexer/lexer_test.go", "../parser/parser_test.go", "../evaluator/evaluator_test.go"} {
+		fset := gotoken.NewFileSet()
+		file, err := goparser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			t.Fatalf("reading %s: %v", filename, err)
+		}
+
+		goast.Inspect(file, func(n goast.Node) bool {
+			lit, ok := n.(*goast.BasicLit)
+			if !ok || lit.Kind != gotoken.STRING {
+				return true
+			}
+			if s, err := strconv.Unquote(lit.Value); err == nil {
+				inputs = append(inputs, s)
+			}
+			return true
+		})
+	}
+
+	return inputs
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := append(corpus(t),
+		"",
+		"   \n\t",
+		"// only a comment",
+		"let x = 5 /* unterminated",
+		"let = ;; ) } ]",
+		"fn(a, {b: }, [1,,2]",
+		"\"unterminated string   \nlet y = 1",
+		"x\x00y",
+		"let s = \"\xff\"; // invalid utf-8 \xfe",
+		"for (let i = 0; i < 3; i += 1) { if (i) { break; } };;",
+		"\r\nlet a = 1;\r\n/* a /* nested */ comment */ a\r\n",
+	)
+	if len(inputs) < 200 {
+		t.Fatalf("only %d inputs found in the tests", len(inputs))
+	}
+
+	for _, input := range inputs {
+		root := Parse("test.mk", input)
+
+		if text := root.Green().Text(); text != input {
+			t.Errorf("round trip of %q gives %q", input, text)
+			continue
+		}
+		if root.Text() != input || root.End() != len(input) {
+			t.Errorf("red root of %q covers %q", input, root.Text())
+		}
+		if last := root.LastToken(); last == nil || !last.Is(token.EOF) {
+			t.Errorf("last token of %q is not EOF", input)
+		}
+		checkOffsets(t, input, root)
+	}
+}
+
+// checkOffsets makes sure every child starts where the previous one ended
+func checkOffsets(t *testing.T, input string, n *Node) {
+	t.Helper()
+
+	offset := n.Offset()
+	for _, child := range n.Children() {
+		switch child := child.(type) {
+		case *Node:
+			if child.Offset() != offset {
+				t.Errorf("%q: %s starts at %d, want %d", input, child.Kind(), child.Offset(), offset)
+			}
+			checkOffsets(t, input, child)
+			offset = child.End()
+		case *Token:
+			start := child.Offset() - child.Green().LeadingWidth()
+			if start != offset {
+				t.Errorf("%q: token %q starts at %d, want %d", input, child.Text(), start, offset)
+			}
+			if got := input[child.Offset() : child.Offset()+len(child.Text())]; got != child.Text() {
+				t.Errorf("%q: token %q is %q in the source", input, child.Text(), got)
+			}
+			offset = child.Offset() + len(child.Text())
+		}
+	}
+
+	if offset != n.End() {
+		t.Errorf("%q: children of %s end at %d, want %d", input, n.Kind(), offset, n.End())
+	}
+}
+
+func TestToAST(t *testing.T) {
+	count := 0
+
+	for _, input := range corpus(t) {
+		l := lexer.NewFile("test.mk", input)
+		l.SetMode(lexer.ScanComments)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			continue
+		}
+		count++
+
+		expected, err := ast.MarshalJSON(program)
+		if err != nil {
+			t.Fatalf("MarshalJSON(%q): %v", input, err)
+		}
+		got, err := ast.MarshalJSON(ToAST(Parse("test.mk", input)))
+		if err != nil {
+			t.Fatalf("MarshalJSON(ToAST(%q)): %v", input, err)
+		}
+
+		if string(got) != string(expected) {
+			t.Errorf("ToAST(%q) is\n%s\nwant\n%s", input, got, expected)
+		}
+	}
+
+	if count < 100 {
+		t.Fatalf("only %d valid programs found in the tests", count)
+	}
+}
+
+// the tree is built from the parser, so even for a broken program ToAST gives
+// the statements the parser gives
+func TestToASTString(t *testing.T) {
+	for _, input := range corpus(t) {
+		l := lexer.NewFile("test.mk", input)
+		l.SetMode(lexer.ScanComments)
+		expected := parser.New(l).ParseProgram().String()
+
+		if got := ToAST(Parse("test.mk", input)).String(); got != expected {
+			t.Errorf("ToAST(%q) is %q, want %q", input, got, expected)
+		}
+	}
+}
+
+func TestToASTBroken(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5; let y = 1;", "<bad statement>let y = 1;"},
+		{"1 + ); x", "(1 + <bad expression>)x"},
+		{"let a = [1, , 2];", "let a = [1, <bad expression>, 2];"},
+		{"if (x { 1 }", "<bad expression>"},
+		{"99999999999999999999", "<bad expression>"},
+		{"for (let i = 0; i < ; i += 1) { i }", "for (let i = 0; (i < <bad expression>); (i += 1)) i"},
+		{"{a: , b: 2}", "{a: <bad expression>, b: 2}"},
+		{"let = ;; ) } ]", "<bad statement><bad expression><bad expression><bad expression>"},
+	}
+
+	for _, tt := range tests {
+		program := ToAST(Parse("", tt.input))
+		if got := program.String(); got != tt.expected {
+			t.Errorf("ToAST(%q) is %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "let x = 1; // one\n\n/* two */ x\n"
+	root := Parse("", input)
+
+	let := root.Nodes()[0]
+	if let.Kind() != LetStatement {
+		t.Fatalf("first node is %s, want LetStatement", let.Kind())
+	}
+	if let.Text() != "let x = 1;" {
+		t.Errorf("let statement text is %q", let.Text())
+	}
+
+	x := root.Nodes()[1].FirstToken()
+	var kinds []string
+	for _, tr := range x.Leading() {
+		if tr.Kind == Comment {
+			kinds = append(kinds, "comment "+tr.Text)
+		} else {
+			kinds = append(kinds, "space "+strconv.Quote(tr.Text))
+		}
+	}
+	expected := []string{`space " "`, "comment // one", `space "\n\n"`, "comment /* two */", `space " "`}
+	if strings.Join(kinds, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("leading trivia of x is %v, want %v", kinds, expected)
+	}
+
+	tok := x.Token()
+	if tok.Pos.Line != 3 || tok.Pos.Column != 11 || len(tok.Comments) != 2 {
+		t.Errorf("x is %+v", tok)
+	}
+	if c := tok.Comments[1]; c.Literal != "/* two */" || c.Pos.Line != 3 || c.Pos.Column != 1 {
+		t.Errorf("second comment of x is %+v", c)
+	}
+
+	eof := root.LastToken()
+	if !eof.Is(token.EOF) || len(eof.Leading()) != 1 || eof.Leading()[0].Text != "\n" {
+		t.Errorf("EOF leading trivia is %+v", eof.Leading())
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	input := "let add = fn(a, b) { a + b };\nadd(1, 2);"
+	root := Parse("", input)
+
+	tok := root.TokenAt(strings.Index(input, "+"))
+	if tok == nil || tok.Text() != "+" {
+		t.Fatalf("TokenAt(+) is %v", tok)
+	}
+
+	var kinds []string
+	for n := tok.Parent(); n != nil; n = n.Parent() {
+		kinds = append(kinds, string(n.Kind()))
+	}
+	expected := "InfixExpression ExpressionStatement BlockStatement FunctionLiteral LetStatement Program"
+	if strings.Join(kinds, " ") != expected {
+		t.Errorf("parents of + are %q, want %q", strings.Join(kinds, " "), expected)
+	}
+
+	call := root.Nodes()[1].Nodes()[0]
+	if call.Kind() != CallExpression || call.Text() != "\nadd(1, 2)" {
+		t.Errorf("call is %s %q", call.Kind(), call.Text())
+	}
+	if args := call.Nodes()[1]; args.Kind() != ArgumentList || len(args.Nodes()) != 2 {
+		t.Errorf("arguments are %s with %d nodes", args.Kind(), len(args.Nodes()))
+	}
+
+	// red节点每次都重新创建，green节点是共享的
+	if a, b := root.Nodes()[0], root.Nodes()[0]; a == b || a.Green() != b.Green() {
+		t.Errorf("red nodes of the same child don't share their green node")
+	}
+}
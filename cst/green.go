@@ -0,0 +1,141 @@
+// Package cst is a lossless concrete syntax tree in the green/red style.
+//
+// The green tree is immutable and knows nothing about positions: a GreenToken
+// holds the exact source text of a token with the whitespace and comments
+// before it, a GreenNode holds its children and its width in bytes. Printing
+// the green root gives back the source byte for byte.
+//
+// The red tree (Node, Token) is a thin view on top of it that is built on
+// demand and adds parents and offsets. ToAST projects it into an ast.Program.
+package cst
+
+import (
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// Kind is the syntactic category of a GreenNode: the type of the ast node the
+// parser built for it, or one of the kinds of package parser for the parts
+// that have no ast node of their own (see parser.NodeKind)
+type Kind = parser.NodeKind
+
+const (
+	Program             Kind = "Program"
+	LetStatement        Kind = "LetStatement"
+	ReturnStatement     Kind = "ReturnStatement"
+	ExpressionStatement Kind = "ExpressionStatement"
+	WhileStatement      Kind = "WhileStatement"
+	ForStatement        Kind = "ForStatement"
+	ForInStatement      Kind = "ForInStatement"
+	BreakStatement      Kind = "BreakStatement"
+	ContinueStatement   Kind = "ContinueStatement"
+	BlockStatement      Kind = "BlockStatement"
+
+	Identifier       Kind = "Identifier"
+	IntegerLiteral   Kind = "IntegerLiteral"
+	FloatLiteral     Kind = "FloatLiteral"
+	BooleanLiteral   Kind = "BooleanLiteral"
+	StringLiteral    Kind = "StringLiteral"
+	ArrayLiteral     Kind = "ArrayLiteral"
+	HashLiteral      Kind = "HashLiteral"
+	HashPair         Kind = parser.HashPair
+	FunctionLiteral  Kind = "FunctionLiteral"
+	ParameterList    Kind = parser.ParameterList
+	ParenExpression  Kind = parser.ParenExpression
+	PrefixExpression Kind = "PrefixExpression"
+	InfixExpression  Kind = "InfixExpression"
+	AssignExpression Kind = "AssignExpression"
+	IfExpression     Kind = "IfExpression"
+	CallExpression   Kind = "CallExpression"
+	ArgumentList     Kind = parser.ArgumentList
+	IndexExpression  Kind = "IndexExpression"
+	MemberExpression Kind = "MemberExpression"
+
+	// a statement or an expression the parser couldn't build keeps its
+	// tokens, a BadExpression is empty where an expression is missing
+	BadStatement  Kind = "BadStatement"
+	BadExpression Kind = "BadExpression"
+)
+
+// TriviaKind tells whitespace from comments
+type TriviaKind int
+
+const (
+	Whitespace TriviaKind = iota
+	Comment
+)
+
+// Trivia is a piece of source text between tokens
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+// GreenElement is a *GreenNode or a *GreenToken
+type GreenElement interface {
+	Width() int
+	writeTo(out *strings.Builder)
+}
+
+// GreenToken is a token with the trivia in front of it. The last token of a
+// tree is EOF, its Leading keeps the trivia at the end of the file
+type GreenToken struct {
+	Type    token.TokenType
+	Text    string // as written in the source
+	Literal string // the value the lexer gives, e.g. a string without quotes
+	Leading []Trivia
+	width   int
+}
+
+func newGreenToken(typ token.TokenType, text, literal string, leading []Trivia) *GreenToken {
+	t := &GreenToken{Type: typ, Text: text, Literal: literal, Leading: leading, width: len(text)}
+	for _, tr := range leading {
+		t.width += len(tr.Text)
+	}
+	return t
+}
+
+// Width is the length of the token text and its leading trivia
+func (t *GreenToken) Width() int { return t.width }
+
+// LeadingWidth is the length of the leading trivia
+func (t *GreenToken) LeadingWidth() int { return t.width - len(t.Text) }
+
+func (t *GreenToken) writeTo(out *strings.Builder) {
+	for _, tr := range t.Leading {
+		out.WriteString(tr.Text)
+	}
+	out.WriteString(t.Text)
+}
+
+// GreenNode is an immutable node, the same GreenNode may appear in several trees
+type GreenNode struct {
+	Kind     Kind
+	Children []GreenElement
+	width    int
+}
+
+func newGreenNode(kind Kind, children ...GreenElement) *GreenNode {
+	n := &GreenNode{Kind: kind, Children: children}
+	for _, c := range children {
+		n.width += c.Width()
+	}
+	return n
+}
+
+func (n *GreenNode) Width() int { return n.width }
+
+func (n *GreenNode) writeTo(out *strings.Builder) {
+	for _, c := range n.Children {
+		c.writeTo(out)
+	}
+}
+
+// Text is the source text covered by the node, trivia included
+func (n *GreenNode) Text() string {
+	var out strings.Builder
+	out.Grow(n.width)
+	n.writeTo(&out)
+	return out.String()
+}
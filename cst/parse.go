@@ -0,0 +1,88 @@
+package cst
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// ========================= tree from the parser ========================= //
+// Parse builds the concrete syntax tree of src from the events of package
+// parser, so the nodes are the ones of the ast. It never fails: a broken
+// statement or expression is a BadStatement or BadExpression node that keeps
+// its tokens, so the text of the root is always src. Use parser.New for the
+// diagnostics
+func Parse(filename string, src string) *Node {
+	l := lexer.NewFile(filename, src)
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	p.SetMode(parser.RecordEvents)
+	p.ParseProgram()
+
+	var root *GreenNode
+	var stack [][]GreenElement
+	end := 0
+
+	for _, e := range p.Events() {
+		top := len(stack) - 1
+
+		switch e.Type {
+		case parser.EventStart:
+			stack = append(stack, nil)
+		case parser.EventToken:
+			var tok *GreenToken
+			tok, end = greenToken(src, end, e.Token)
+			stack[top] = append(stack[top], tok)
+		case parser.EventFinish:
+			node := newGreenNode(e.Kind, stack[top]...)
+			stack = stack[:top]
+			if top == 0 {
+				root = node
+			} else {
+				stack[top-1] = append(stack[top-1], node)
+			}
+		}
+	}
+
+	return NewRoot(filename, root)
+}
+
+// greenToken turns tok into a GreenToken, the source between end (where the
+// previous token stopped) and tok is its leading trivia. It returns where tok
+// stops, EOF takes the rest of src
+func greenToken(src string, end int, tok token.Token) (*GreenToken, int) {
+	var leading []Trivia
+	for _, c := range tok.Comments {
+		start := clamp(c.Pos.Offset, end, len(src))
+		leading = appendWhitespace(leading, src[end:start])
+		end = clamp(c.End.Offset, start, len(src))
+		leading = append(leading, Trivia{Kind: Comment, Text: src[start:end]})
+	}
+
+	start := clamp(tok.Pos.Offset, end, len(src))
+	leading = appendWhitespace(leading, src[end:start])
+
+	end = clamp(tok.End.Offset, start, len(src))
+	if tok.Type == token.EOF {
+		end = len(src)
+	}
+
+	return newGreenToken(tok.Type, src[start:end], tok.Literal, leading), end
+}
+
+func clamp(offset, low, high int) int {
+	if offset < low {
+		return low
+	}
+	if offset > high {
+		return high
+	}
+	return offset
+}
+
+func appendWhitespace(trivia []Trivia, text string) []Trivia {
+	if text == "" {
+		return trivia
+	}
+	return append(trivia, Trivia{Kind: Whitespace, Text: text})
+}
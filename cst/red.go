@@ -0,0 +1,211 @@
+package cst
+
+import (
+	"monkey/token"
+	"sort"
+	"unicode/utf8"
+)
+
+// ========================= red tree ========================= //
+// Element is a *Node or a *Token of the red tree
+type Element interface {
+	Parent() *Node
+	element()
+}
+
+// Node is a GreenNode at a given place: it knows its parent and its offset.
+// Red nodes are cheap and created on demand, compare their Green() to know if
+// two of them are the same node
+type Node struct {
+	green  *GreenNode
+	parent *Node
+	offset int // start of the text of the node, leading trivia included
+	file   *file
+}
+
+// file turns offsets into positions for the whole tree
+type file struct {
+	name       string
+	lineStarts []int
+	text       string
+}
+
+func newFile(name, text string) *file {
+	f := &file{name: name, lineStarts: []int{0}, text: text}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			f.lineStarts = append(f.lineStarts, i+1)
+		}
+	}
+	return f
+}
+
+// position works like the lexer: lines and columns start from 1, Column
+// counts bytes and RuneColumn counts runes
+func (f *file) position(offset int) token.Position {
+	line := sort.Search(len(f.lineStarts), func(i int) bool { return f.lineStarts[i] > offset }) - 1
+	start := f.lineStarts[line]
+
+	return token.Position{
+		Filename:   f.name,
+		Offset:     offset,
+		Line:       line + 1,
+		Column:     offset - start + 1,
+		RuneColumn: utf8.RuneCountInString(f.text[start:offset]) + 1,
+	}
+}
+
+// NewRoot makes the red root of a green tree, the whole text of the tree is
+// the source that filename refers to
+func NewRoot(filename string, green *GreenNode) *Node {
+	return &Node{green: green, file: newFile(filename, green.Text())}
+}
+
+func (n *Node) element() {}
+
+func (n *Node) Green() *GreenNode { return n.green }
+func (n *Node) Kind() Kind        { return n.green.Kind }
+func (n *Node) Parent() *Node     { return n.parent }
+
+// Offset is where the node starts, the trivia before its first token included
+func (n *Node) Offset() int { return n.offset }
+
+// End is the offset right after the node
+func (n *Node) End() int { return n.offset + n.green.Width() }
+
+// Text is the exact source of the node, the trivia before its first token included
+func (n *Node) Text() string { return n.file.text[n.offset:n.End()] }
+
+// Children returns the child nodes and tokens in source order
+func (n *Node) Children() []Element {
+	children := make([]Element, 0, len(n.green.Children))
+	offset := n.offset
+
+	for _, c := range n.green.Children {
+		switch c := c.(type) {
+		case *GreenNode:
+			children = append(children, &Node{green: c, parent: n, offset: offset, file: n.file})
+		case *GreenToken:
+			children = append(children, &Token{green: c, parent: n, offset: offset})
+		}
+		offset += c.Width()
+	}
+
+	return children
+}
+
+// Nodes returns the child nodes, tokens left out
+func (n *Node) Nodes() []*Node {
+	var nodes []*Node
+	for _, c := range n.Children() {
+		if c, ok := c.(*Node); ok {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// Tokens returns the tokens that are direct children of n
+func (n *Node) Tokens() []*Token {
+	var tokens []*Token
+	for _, c := range n.Children() {
+		if c, ok := c.(*Token); ok {
+			tokens = append(tokens, c)
+		}
+	}
+	return tokens
+}
+
+// FirstToken is the first token under n, nil if n has no tokens at all
+func (n *Node) FirstToken() *Token {
+	for _, c := range n.Children() {
+		switch c := c.(type) {
+		case *Token:
+			return c
+		case *Node:
+			if t := c.FirstToken(); t != nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// LastToken is the last token under n, nil if n has no tokens at all
+func (n *Node) LastToken() *Token {
+	children := n.Children()
+	for i := len(children) - 1; i >= 0; i-- {
+		switch c := children[i].(type) {
+		case *Token:
+			return c
+		case *Node:
+			if t := c.LastToken(); t != nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// TokenAt returns the token under n whose text or leading trivia covers
+// offset, nil if offset is outside of n
+func (n *Node) TokenAt(offset int) *Token {
+	for _, c := range n.Children() {
+		switch c := c.(type) {
+		case *Token:
+			if offset >= c.offset && offset < c.offset+c.green.Width() {
+				return c
+			}
+		case *Node:
+			if offset >= c.offset && offset < c.End() {
+				return c.TokenAt(offset)
+			}
+		}
+	}
+
+	// EOF has no width, it is at the very end
+	if last := n.LastToken(); last != nil && last.Is(token.EOF) && offset == n.End() {
+		return last
+	}
+	return nil
+}
+
+// Token is a GreenToken at a given place
+type Token struct {
+	green  *GreenToken
+	parent *Node
+	offset int // start of the leading trivia
+}
+
+func (t *Token) element() {}
+
+func (t *Token) Green() *GreenToken          { return t.green }
+func (t *Token) Parent() *Node               { return t.parent }
+func (t *Token) Type() token.TokenType       { return t.green.Type }
+func (t *Token) Text() string                { return t.green.Text }
+func (t *Token) Literal() string             { return t.green.Literal }
+func (t *Token) Leading() []Trivia           { return t.green.Leading }
+func (t *Token) Is(typ token.TokenType) bool { return t.green.Type == typ }
+
+// Offset is where the token text starts, after its leading trivia
+func (t *Token) Offset() int { return t.offset + t.green.LeadingWidth() }
+
+func (t *Token) Pos() token.Position { return t.parent.file.position(t.Offset()) }
+
+// Token converts t into the token the lexer gives in lexer.ScanComments mode
+func (t *Token) Token() token.Token {
+	f := t.parent.file
+	tok := token.Token{Type: t.green.Type, Literal: t.green.Literal, Pos: t.Pos(),
+		End: f.position(t.Offset() + len(t.green.Text))}
+
+	offset := t.offset
+	for _, tr := range t.green.Leading {
+		if tr.Kind == Comment {
+			tok.Comments = append(tok.Comments, token.Token{Type: token.COMMENT, Literal: tr.Text,
+				Pos: f.position(offset), End: f.position(offset + len(tr.Text))})
+		}
+		offset += len(tr.Text)
+	}
+
+	return tok
+}
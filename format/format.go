@@ -0,0 +1,598 @@
+// Package format pretty-prints Monkey programs in a canonical layout:
+//
+//   - one statement per line, blocks indented by four spaces
+//   - let, return, break, continue and expression statements end with ';',
+//     an if expression standing alone as a statement doesn't
+//   - parentheses only where the parser's precedence table needs them
+//   - comments and single blank lines between statements are kept
+//
+// Array, hash and argument lists stay on one line, unless the first element
+// starts on a new line in the source, then every element gets its own line.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+const indentation = "    "
+
+// Source formats a whole program, src must parse without errors. The
+// diagnostics are returned as a parser.ErrorList otherwise
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+
+	pr := &printer{src: scan(string(src))}
+	pr.program(program)
+	return pr.bytes(), nil
+}
+
+// Node formats node without comments or blank lines, e.g. a tree built by hand
+// or rewritten with ast.Modify. A program ends with a newline, a statement or an
+// expression doesn't
+func Node(node ast.Node) string {
+	pr := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+		return string(pr.bytes())
+	case ast.Statement:
+		pr.statement(node, nil)
+	case ast.Expression:
+		pr.expr(node)
+	}
+	return pr.out.String()
+}
+
+// ===================== 源码信息 ================
+// source holds what the AST lost: comments, blank lines and closing brackets
+type source struct {
+	comments []comment
+	blank    map[int]bool           // token offset -> an empty line is right before the token
+	closing  map[int]token.Position // offset of ( [ { -> its closing bracket
+}
+
+type comment struct {
+	tok         token.Token
+	trailing    bool // on the same line as the code before it
+	blankBefore bool
+}
+
+func scan(src string) *source {
+	s := &source{blank: map[int]bool{}, closing: map[int]token.Position{}}
+
+	l := lexer.New(src)
+	l.SetMode(lexer.ScanComments)
+
+	codeLine := 0 // line of the last token that isn't a comment
+	endLine := 0  // last line of the last token or comment
+	var open []int
+
+	for {
+		tok := l.NextToken()
+
+		for _, c := range tok.Comments {
+			s.comments = append(s.comments, comment{
+				tok:         c,
+				trailing:    c.Pos.Line == codeLine,
+				blankBefore: endLine > 0 && c.Pos.Line > endLine+1,
+			})
+			endLine = c.Pos.Line + strings.Count(c.Literal, "\n")
+		}
+
+		if tok.Type == token.EOF {
+			return s
+		}
+
+		s.blank[tok.Pos.Offset] = endLine > 0 && tok.Pos.Line > endLine+1
+		codeLine, endLine = tok.Pos.Line, tok.Pos.Line
+
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if len(open) > 0 {
+				s.closing[open[len(open)-1]] = tok.Pos
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
+
+// ===================== 输出 ================
+// printer writes lazily: after a line of code pending is set and the newline is
+// only written before the next output, so that a trailing comment can still go
+// at the end of the line
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	src    *source // nil when formatting a bare node
+	next   int     // index of the next comment to print
+
+	pending    bool // the current line is done
+	lineStart  bool // nothing written on the current line yet
+	blockStart bool // nothing written since the last '{', '[' or '('
+	trailed    bool // the current line already ends with a comment
+}
+
+func (p *printer) bytes() []byte {
+	if p.pending {
+		p.out.WriteByte('\n')
+	}
+	return p.out.Bytes()
+}
+
+func (p *printer) write(s string) {
+	p.realize()
+	if p.lineStart {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+	}
+	p.out.WriteString(s)
+	p.lineStart = false
+	p.blockStart = false
+}
+
+// realize writes the pending newline
+func (p *printer) realize() {
+	if p.pending {
+		p.out.WriteByte('\n')
+		p.pending = false
+		p.lineStart = true
+		p.trailed = false
+	}
+}
+
+// startLine makes sure the next output goes on a new line, after an empty line if blank
+func (p *printer) startLine(blank bool) {
+	if !p.lineStart && !p.pending && p.out.Len() > 0 {
+		p.pending = true
+	}
+	p.realize()
+	if blank && !p.blockStart && p.out.Len() > 0 {
+		p.out.WriteByte('\n')
+	}
+}
+
+// open writes a bracket that is followed by indented lines
+func (p *printer) open(bracket string) {
+	p.write(bracket)
+	p.indent++
+	p.pending = true
+	p.blockStart = true
+}
+
+func (p *printer) close(bracket string) {
+	p.indent--
+	p.startLine(false)
+	p.write(bracket)
+}
+
+// flush prints the comments before offset
+func (p *printer) flush(offset int) {
+	for p.hasComments(offset) {
+		c := p.src.comments[p.next]
+		p.next++
+
+		if c.trailing && p.pending && !p.trailed {
+			p.out.WriteString(" " + c.tok.Literal)
+			p.trailed = true
+			continue
+		}
+
+		p.startLine(c.blankBefore)
+		p.write(c.tok.Literal)
+		p.pending = true
+		p.trailed = true
+	}
+}
+
+func (p *printer) hasComments(offset int) bool {
+	return p.src != nil && p.next < len(p.src.comments) && p.src.comments[p.next].tok.Pos.Offset < offset
+}
+
+// closeOffset is the offset of the bracket closing the one at tok, -1 if unknown
+func (p *printer) closeOffset(tok token.Token) int {
+	if p.src == nil {
+		return -1
+	}
+	if pos, ok := p.src.closing[tok.Pos.Offset]; ok && tok.Pos.IsValid() {
+		return pos.Offset
+	}
+	return -1
+}
+
+func (p *printer) blankBefore(tok token.Token) bool {
+	return p.src != nil && tok.Pos.IsValid() && p.src.blank[tok.Pos.Offset]
+}
+
+// ===================== 语句 ================
+func (p *printer) program(program *ast.Program) {
+	p.lineStart = true
+	p.blockStart = true
+	p.statements(program.Statements)
+	p.flush(math.MaxInt)
+}
+
+func (p *printer) statements(list []ast.Statement) {
+	for i, stmt := range list {
+		var next ast.Statement
+		if i+1 < len(list) {
+			next = list[i+1]
+		}
+
+		tok := firstToken(stmt)
+		if tok.Pos.IsValid() {
+			p.flush(tok.Pos.Offset)
+		}
+		p.startLine(p.blankBefore(tok))
+		p.statement(stmt, next)
+		p.pending = true
+	}
+}
+
+// statement prints stmt without a newline, next is needed to know if an if
+// expression can go without ';'
+func (p *printer) statement(stmt ast.Statement, next ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.letStatement(stmt)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expr(stmt.ReturnValue)
+		}
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expr(stmt.Expression)
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok || continuesExpression(next) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expr(stmt.Condition)
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.ForStatement:
+		p.write("for (")
+		switch init := stmt.Init.(type) {
+		case *ast.LetStatement:
+			p.letStatement(init)
+		case *ast.ExpressionStatement:
+			p.expr(init.Expression)
+		}
+		p.write(";")
+		if stmt.Condition != nil {
+			p.write(" ")
+			p.expr(stmt.Condition)
+		}
+		p.write(";")
+		if stmt.Update != nil {
+			p.write(" ")
+			p.expr(stmt.Update)
+		}
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.ForInStatement:
+		p.write("for (" + stmt.Variable.Value + " in ")
+		p.expr(stmt.Iterable)
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.BreakStatement:
+		p.write("break;")
+	case *ast.ContinueStatement:
+		p.write("continue;")
+	default:
+		p.write(stmt.String())
+	}
+}
+
+func (p *printer) letStatement(stmt *ast.LetStatement) {
+	p.write("let " + stmt.Name.Value + " = ")
+	p.expr(stmt.Value)
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	end := p.closeOffset(block.Token)
+	if len(block.Statements) == 0 && !p.hasComments(end) {
+		p.write("{}")
+		return
+	}
+
+	p.open("{")
+	p.statements(block.Statements)
+	p.flush(end)
+	p.close("}")
+}
+
+// continuesExpression reports whether next would be parsed as the rest of the
+// expression before it when there is no ';' in between, e.g. "(x)" becomes a call
+func continuesExpression(next ast.Statement) bool {
+	if _, ok := next.(*ast.ExpressionStatement); !ok {
+		return false
+	}
+	s := Node(next)
+	return strings.HasPrefix(s, "(") || strings.HasPrefix(s, "[") || strings.HasPrefix(s, "-")
+}
+
+// firstToken is the token a statement starts with in the source
+func firstToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.WhileStatement:
+		return stmt.Token
+	case *ast.ForStatement:
+		return stmt.Token
+	case *ast.ForInStatement:
+		return stmt.Token
+	case *ast.BreakStatement:
+		return stmt.Token
+	case *ast.ContinueStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+// ===================== 表达式 ================
+func (p *printer) expr(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		// 保留原来的写法，比如0xFF或1_000
+		if exp.Token.Type == token.INT {
+			p.write(exp.Token.Literal)
+		} else {
+			p.write(strconv.FormatInt(exp.Value, 10))
+		}
+	case *ast.FloatLiteral:
+		if exp.Token.Type == token.FLOAT {
+			p.write(exp.Token.Literal)
+		} else {
+			p.write(formatFloat(exp.Value))
+		}
+	case *ast.BooleanLiteral:
+		p.write(strconv.FormatBool(exp.Value))
+	case *ast.StringLiteral:
+		p.write(quote(exp.Value))
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.operand(exp.Right, isOperator(exp.Right) && precedence(exp.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(exp)
+		p.operand(exp.Left, isOperator(exp.Left) && precedence(exp.Left) < prec)
+		p.write(" " + exp.Operator + " ")
+		p.operand(exp.Right, isOperator(exp.Right) && precedence(exp.Right) <= prec)
+	case *ast.AssignExpression:
+		p.expr(exp.Target)
+		p.write(" " + exp.Operator + " ")
+		p.expr(exp.Value)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expr(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn(" + exp.Parameters.String() + ") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.operand(exp.Function, isOperator(exp.Function))
+		p.list(exp.Token, "(", exp.Arguments, ")")
+	case *ast.IndexExpression:
+		p.operand(exp.Left, isOperator(exp.Left))
+		p.write("[")
+		p.expr(exp.Index)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.operand(exp.Object, isOperator(exp.Object))
+		p.write("." + exp.Property.Value)
+	case *ast.ArrayLiteral:
+		p.list(exp.Token, "[", exp.Elements, "]")
+	case *ast.HashLiteral:
+		p.hash(exp)
+	default:
+		p.write(exp.String())
+	}
+}
+
+func (p *printer) operand(exp ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+	}
+	p.expr(exp)
+	if parens {
+		p.write(")")
+	}
+}
+
+// isOperator is true for expressions that end with an operand, only those can
+// lose their right operand to a stronger operator next to them
+func isOperator(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.PrefixExpression, *ast.InfixExpression, *ast.AssignExpression:
+		return true
+	}
+	return false
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.InfixExpression:
+		// 手写的树可能没有token，从运算符得到token类型
+		return parser.Precedence(lexer.New(exp.Operator).NextToken().Type)
+	}
+	return parser.INDEX
+}
+
+// list prints comma separated elements between brackets, one per line when the
+// first one starts on a new line in the source
+func (p *printer) list(open token.Token, left string, elements []ast.Expression, right string) {
+	if !p.multiline(open, elements) {
+		p.write(left)
+		for i, elem := range elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(elem)
+		}
+		p.write(right)
+		return
+	}
+
+	p.open(left)
+	for i, elem := range elements {
+		p.flush(leftmost(elem).Offset)
+		p.startLine(false)
+		p.expr(elem)
+		if i < len(elements)-1 {
+			p.write(",")
+		}
+		p.pending = true
+	}
+	p.flush(p.closeOffset(open))
+	p.close(right)
+}
+
+func (p *printer) hash(hash *ast.HashLiteral) {
+	if !p.multiline(hash.Token, hash.Keys) {
+		p.write("{")
+		for i, key := range hash.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(key)
+			p.write(": ")
+			p.expr(hash.Pairs[key])
+		}
+		p.write("}")
+		return
+	}
+
+	p.open("{")
+	for i, key := range hash.Keys {
+		p.flush(leftmost(key).Offset)
+		p.startLine(false)
+		p.expr(key)
+		p.write(": ")
+		p.expr(hash.Pairs[key])
+		if i < len(hash.Keys)-1 {
+			p.write(",")
+		}
+		p.pending = true
+	}
+	p.flush(p.closeOffset(hash.Token))
+	p.close("}")
+}
+
+func (p *printer) multiline(open token.Token, elements []ast.Expression) bool {
+	if p.src == nil || len(elements) == 0 || !open.Pos.IsValid() {
+		return false
+	}
+	return leftmost(elements[0]).Line > open.Pos.Line
+}
+
+// leftmost is the position of the first token of exp
+func leftmost(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return leftmost(exp.Left)
+	case *ast.AssignExpression:
+		return leftmost(exp.Target)
+	case *ast.CallExpression:
+		return leftmost(exp.Function)
+	case *ast.IndexExpression:
+		return leftmost(exp.Left)
+	case *ast.MemberExpression:
+		return leftmost(exp.Object)
+	case *ast.Identifier:
+		return exp.Token.Pos
+	case *ast.IntegerLiteral:
+		return exp.Token.Pos
+	case *ast.FloatLiteral:
+		return exp.Token.Pos
+	case *ast.BooleanLiteral:
+		return exp.Token.Pos
+	case *ast.StringLiteral:
+		return exp.Token.Pos
+	case *ast.PrefixExpression:
+		return exp.Token.Pos
+	case *ast.IfExpression:
+		return exp.Token.Pos
+	case *ast.FunctionLiteral:
+		return exp.Token.Pos
+	case *ast.ArrayLiteral:
+		return exp.Token.Pos
+	case *ast.HashLiteral:
+		return exp.Token.Pos
+	}
+	return token.Position{}
+}
+
+// formatFloat always writes a '.' or an exponent, so the literal stays a float
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// quote writes a string literal the lexer reads back as s
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&out, `\u{%x}`, r)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
@@ -0,0 +1,201 @@
+package format
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"let x = 007", "let x = 007;\n"},
+		{"return", "return;\n"},
+		{"x", "x;\n"},
+		{"", ""},
+		// 最少的括号
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"(-a) * b", "-a * b;\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"(f(x))[0].y", "f(x)[0].y;\n"},
+		{"a = (b = c)", "a = b = c;\n"},
+		{"(a = b) + 1", "(a = b) + 1;\n"},
+		{"a || (b && c)", "a || b && c;\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"(a & b) == c", "(a & b) == c;\n"},
+		{"a & (b == c)", "a & b == c;\n"},
+		{"(1 << 2) + 3", "(1 << 2) + 3;\n"},
+		{"!(!a)", "!!a;\n"},
+		// 字面量
+		{`"a\"b\\c\nd\u{7}"`, `"a\"b\\c\nd\u{7}";` + "\n"},
+		{"0xFF + 1_000 + 1.5e3", "0xFF + 1_000 + 1.5e3;\n"},
+		{"[1,2,  3]", "[1, 2, 3];\n"},
+		{`{"a":1, true : [] }`, `{"a": 1, true: []};` + "\n"},
+		{"{}", "{};\n"},
+		// 语句和代码块
+		{"fn(a,b){a+b}", "fn(a, b) {\n    a + b;\n};\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"if(x){1}else{2}", "if (x) {\n    1;\n} else {\n    2;\n}\n"},
+		{"if (x) { 1 }; -1", "if (x) {\n    1;\n};\n-1;\n"},
+		{"if (x) { 1 }; (y)", "if (x) {\n    1;\n}\ny;\n"},
+		{"if (x) { 1 }; [y]", "if (x) {\n    1;\n};\n[y];\n"},
+		{"while(x<3){x+=1}", "while (x < 3) {\n    x += 1;\n}\n"},
+		{"for(let i=0;i<3;i+=1){break}", "for (let i = 0; i < 3; i += 1) {\n    break;\n}\n"},
+		{"for(;;){continue}", "for (;;) {\n    continue;\n}\n"},
+		{"for(x in [1]){}", "for (x in [1]) {}\n"},
+		// 注释和空行
+		{"// a\nlet x = 1; // b\n\n\n// c\n\nx", "// a\nlet x = 1; // b\n\n// c\n\nx;\n"},
+		{"/* a */ x /* b */ /* c */", "/* a */\nx; /* b */\n/* c */\n"},
+		{"if (x) { // a\n y // b\n // c\n}", "if (x) { // a\n    y; // b\n    // c\n}\n"},
+		{"if (x) {\n // only\n}", "if (x) {\n    // only\n}\n"},
+		{"let a = 1 + // moved\n 2;", "let a = 1 + 2; // moved\n"},
+		{"f(\n1, // one\n2)", "f(\n    1, // one\n    2\n);\n"},
+		{"let h = {\n\"a\": 1,\n\n\"b\": 2}", "let h = {\n    \"a\": 1,\n    \"b\": 2\n};\n"},
+		{"[1,\n2]", "[1, 2];\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("%q:\n got %q\nwant %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	if err == nil {
+		t.Fatalf("no error for a broken program")
+	}
+	if _, ok := err.(parser.ErrorList); !ok {
+		t.Errorf("error is %T, want parser.ErrorList", err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	ident := func(name string) *ast.Identifier { return &ast.Identifier{Value: name} }
+
+	// (a + b) * -c，树是手写的，没有token
+	exp := &ast.InfixExpression{
+		Left:     &ast.InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")},
+		Operator: "*",
+		Right:    &ast.PrefixExpression{Operator: "-", Right: ident("c")},
+	}
+	if got := Node(exp); got != "(a + b) * -c" {
+		t.Errorf("got %q, want %q", got, "(a + b) * -c")
+	}
+
+	stmt := &ast.LetStatement{Name: ident("x"), Value: &ast.FloatLiteral{Value: 2}}
+	if got := Node(stmt); got != "let x = 2.0;" {
+		t.Errorf("got %q, want %q", got, "let x = 2.0;")
+	}
+
+	program := &ast.Program{Statements: []ast.Statement{
+		stmt,
+		&ast.ExpressionStatement{Expression: &ast.StringLiteral{Value: "hi"}},
+	}}
+	if got := Node(program); got != "let x = 2.0;\n\"hi\";\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// corpus collects every string constant of the parser tests that is a valid
+// program, so new parser tests are covered automatically
+func corpus(t *testing.T) []string {
+	fset := gotoken.NewFileSet()
+	file, err := goparser.ParseFile(fset, "../parser/parser_test.go", nil, 0)
+	if err != nil {
+		t.Fatalf("reading the parser tests: %v", err)
+	}
+
+	var inputs []string
+	goast.Inspect(file, func(n goast.Node) bool {
+		lit, ok := n.(*goast.BasicLit)
+		if !ok || lit.Kind != gotoken.STRING {
+			return true
+		}
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		if p := parse(s); p != nil {
+			inputs = append(inputs, s)
+		}
+		return true
+	})
+	return inputs
+}
+
+func parse(src string) *ast.Program {
+	l := lexer.New(src)
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil
+	}
+	return program
+}
+
+func TestIdempotence(t *testing.T) {
+	inputs := corpus(t)
+	if len(inputs) < 100 {
+		t.Fatalf("only %d programs found in the parser tests", len(inputs))
+	}
+
+	for _, input := range inputs {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("%q: formatted code doesn't parse: %v\n%s", input, err, once)
+			continue
+		}
+		if string(twice) != string(once) {
+			t.Errorf("%q: not idempotent:\n%s\n----\n%s", input, once, twice)
+		}
+
+		// 格式化不能改变程序的意思
+		if got, want := parse(string(once)).String(), parse(input).String(); got != want {
+			t.Errorf("%q: program changed:\n got %s\nwant %s", input, got, want)
+		}
+		if got, want := countComments(string(once)), countComments(input); got != want {
+			t.Errorf("%q: %d comments after formatting, want %d", input, got, want)
+		}
+	}
+}
+
+func countComments(src string) int {
+	l := lexer.New(src)
+	l.SetMode(lexer.ScanComments)
+
+	n := 0
+	for {
+		tok := l.NextToken()
+		n += len(tok.Comments)
+		if tok.Type == token.EOF {
+			return n
+		}
+	}
+}
@@ -1,38 +1,133 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"io"
+	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
-	input 	  string
+	src       io.Reader
+	buf       []byte // input bytes not discarded yet, see reader.go
+	base      int    // offset of buf[0] in the input
+	readErr   error  // error returned by src, io.EOF at the end
+	filename  string
 	position  int  // current position in input (points to current char)
 	readPosition int // current reading position in input (after current char)
-	ch        byte // current char under examination
+	ch        rune // current char under examination, utf8 decoded
+	line      int  // line of ch, start from 1
+	lineStart int  // offset of the first byte of the line
+	runeColumn int // column of ch counted in runes, start from 1
+	atEOF     bool
+	errReported bool // readErr has been returned as an ILLEGAL token
+	errors    []*Error
+	mode      Mode
 } 
 
+// Mode controls what the lexer keeps besides the tokens
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota    // attach comments to Token.Comments of the next token
+)
+
+// Error explains why the lexer returned an ILLEGAL token
+type Error struct {
+	Pos token.Position    // where the problem is, inside the ILLEGAL token
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
 // that means New is a construction funciton that can construct a Lexer pointer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile is like New, but every token's position also records the filename
+func NewFile(filename string, input string) *Lexer {
+	return NewFileReader(filename, strings.NewReader(input))
+}
+
+// NewReader reads the input from r incrementally, only the current token is
+// kept in memory, so r may be a pipe or a file much bigger than the memory
+func NewReader(r io.Reader) *Lexer {
+	return NewFileReader("", r)
+}
+
+// NewFileReader is like NewReader, but every token's position also records the filename
+func NewFileReader(filename string, r io.Reader) *Lexer {
+	l := &Lexer{src: r, filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 // that means reachar is a method of Lexer struct
+// it decodes one utf8 rune, an invalid byte is read as utf8.RuneError
 func (l* Lexer)readChar() {
-	if l.readPosition >= len(l.input) {
+	// EOF之后位置不再前进
+	if l.atEOF {
+		return
+	}
+
+	// 换行之后行号加一，列号归零
+	if l.ch == '\n' {
+		l.line += 1
+		l.lineStart = l.readPosition
+		l.runeColumn = 0
+	}
+	l.runeColumn += 1
+
+	ch, width := l.runeAt(l.readPosition)
+	if width == 0 {
 		l.ch = 0
+		l.atEOF = true
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch = ch
 	}
 
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+}
+
+// SetMode changes the mode, the default mode 0 drops comments
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
 }
 
 // that means NextToken is a method of Lexer struct
-func (l* Lexer)NextToken() token.Token{
+func (l *Lexer) NextToken() token.Token {
+	// 之前的token已经返回了，不再需要它们的源码
+	l.discard(l.position)
+
+	comments, illegal := l.skipComments()
+
+	var tok token.Token
+	if illegal != nil {
+		tok = *illegal
+	} else {
+		tok = l.nextToken()
+	}
+
+	// 一个token的源码可能和Literal不一样，比如字符串
+	tok.End = l.pos()
+
+	if l.mode&ScanComments != 0 {
+		tok.Comments = comments
+	}
+	return tok
+}
+
+// nextToken reads the token at l.ch, comments are already skipped
+func (l* Lexer)nextToken() token.Token{
 	var tok token.Token
 
-	l.skipWhitespace()
+	pos := l.pos()
 
 	switch l.ch {
 		// for '=' and '!' branch, need to do some extension
@@ -53,14 +148,39 @@ func (l* Lexer)NextToken() token.Token{
 			tok = newToken(token.RPAREN, l.ch)
 		case ',':
 			tok = newToken(token.COMMA, l.ch)
+		case ':':
+			tok = newToken(token.COLON, l.ch)
+		case '.':
+			tok = newToken(token.DOT, l.ch)
 		case '+':
-			tok = newToken(token.PLUS, l.ch)
+			if l.peekChar() == '=' {
+				tok = l.readTwoCharToken(token.PLUS_ASSIGN)
+			} else {
+				tok = newToken(token.PLUS, l.ch)
+			}
 		case '{':
 			tok = newToken(token.LBRACE, l.ch)
 		case '}':
 			tok = newToken(token.RBRACE, l.ch)
+		case '[':
+			tok = newToken(token.LBRACKET, l.ch)
+		case ']':
+			tok = newToken(token.RBRACKET, l.ch)
+		case '"':
+			// 字符串有错误时返回ILLEGAL，Literal是原始的源码
+			value, ok := l.readString()
+			if ok {
+				tok.Type = token.STRING
+			} else {
+				tok.Type = token.ILLEGAL
+			}
+			tok.Literal = value
 		case '-':
-			tok = newToken(token.MINUS, l.ch)
+			if l.peekChar() == '=' {
+				tok = l.readTwoCharToken(token.MINUS_ASSIGN)
+			} else {
+				tok = newToken(token.MINUS, l.ch)
+			}
 		case '!':
 			if l.peekChar() == '=' {
 				ch := l.ch
@@ -70,70 +190,438 @@ func (l* Lexer)NextToken() token.Token{
 				tok = newToken(token.BANG, l.ch)
 			}
 		case '/':
-			tok = newToken(token.SLASH, l.ch)
+			if l.peekChar() == '=' {
+				tok = l.readTwoCharToken(token.SLASH_ASSIGN)
+			} else {
+				tok = newToken(token.SLASH, l.ch)
+			}
 		case '*':
-			tok = newToken(token.ASTERISK, l.ch)
+			if l.peekChar() == '=' {
+				tok = l.readTwoCharToken(token.ASTERISK_ASSIGN)
+			} else {
+				tok = newToken(token.ASTERISK, l.ch)
+			}
+		case '%':
+			if l.peekChar() == '=' {
+				tok = l.readTwoCharToken(token.PERCENT_ASSIGN)
+			} else {
+				tok = newToken(token.PERCENT, l.ch)
+			}
 		case '<':
-			tok = newToken(token.LT, l.ch)
+			switch l.peekChar() {
+			case '=':
+				tok = l.readTwoCharToken(token.LT_EQ)
+			case '<':
+				tok = l.readTwoCharToken(token.SHL)
+			default:
+				tok = newToken(token.LT, l.ch)
+			}
 		case '>':
-			tok = newToken(token.GT, l.ch)
+			switch l.peekChar() {
+			case '=':
+				tok = l.readTwoCharToken(token.GT_EQ)
+			case '>':
+				tok = l.readTwoCharToken(token.SHR)
+			default:
+				tok = newToken(token.GT, l.ch)
+			}
+		case '&':
+			if l.peekChar() == '&' {
+				tok = l.readTwoCharToken(token.AND)
+			} else {
+				tok = newToken(token.BIT_AND, l.ch)
+			}
+		case '|':
+			if l.peekChar() == '|' {
+				tok = l.readTwoCharToken(token.OR)
+			} else {
+				tok = newToken(token.BIT_OR, l.ch)
+			}
+		case '^':
+			tok = newToken(token.BIT_XOR, l.ch)
+		case '~':
+			tok = newToken(token.BIT_NOT, l.ch)
 		case 0:
-			tok.Literal = ""
-			tok.Type = token.EOF
+			if !l.atEOF {
+				l.addError(pos, "illegal character NUL")
+				tok = newToken(token.ILLEGAL, l.ch)
+			} else if l.readErr != io.EOF && !l.errReported {
+				// 读取出错只报告一次，之后都是EOF
+				l.errReported = true
+				l.addError(pos, fmt.Sprintf("read error: %s", l.readErr))
+				tok.Type = token.ILLEGAL
+			} else {
+				tok.Literal = ""
+				tok.Type = token.EOF
+			}
 		default:
 			if isLetter(l.ch) {
 				// get the content of token and the type of token
 				tok.Literal = l.readIdentifier()
 				tok.Type = token.LookupIdent(tok.Literal)
+				tok.Pos = pos
 				return tok
 			} else if isDigit(l.ch) {
-				tok.Type = token.INT
-				tok.Literal = l.readNumber()
+				tok.Type, tok.Literal = l.readNumber()
+				tok.Pos = pos
 				return tok
+			} else if l.ch == utf8.RuneError {
+				l.addError(pos, "invalid UTF-8 encoding")
+				tok.Type = token.ILLEGAL
+				tok.Literal = l.text(l.position, l.readPosition)
 			} else {
+				l.addError(pos, fmt.Sprintf("illegal character %q", l.ch))
 				tok = newToken(token.ILLEGAL, l.ch)
 			}	
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// the current char and the next one make a two-char operator, like "<="
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+// position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.position - l.lineStart + 1,
+		RuneColumn: l.runeColumn,
+	}
+}
+
 // read identifier
 // get the start of identifier and the end of the identifier
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isIdentifierChar(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	return l.text(position, l.position)
+}
+
+// Errors returns the errors of the ILLEGAL tokens returned so far
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) addError(pos token.Position, msg string) {
+	l.errors = append(l.errors, &Error{Pos: pos, Msg: msg})
 }
 
-// read digit
-func (l *Lexer) readNumber() string {
+// read string between the quotes and decode the escapes, l.ch stops at the closing quote.
+// a string can't span lines: when it is not terminated or contains a bad escape,
+// ok is false and the raw source is returned instead, only the first problem is reported.
+// a NUL byte is a char of the string like any other
+func (l *Lexer) readString() (string, bool) {
+	start := l.position
+	var out strings.Builder
+	ok := true
+
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == '"':
+			if !ok {
+				return l.text(start, l.position+1), false
+			}
+			return out.String(), true
+		case l.atEOF, l.ch == '\n':
+			// 不吃掉换行，后面的代码还能继续解析
+			if ok {
+				l.addError(l.pos(), "string literal not terminated")
+			}
+			return l.text(start, l.position), false
+		case l.ch == '\\':
+			// 反斜杠后面是换行或EOF时，交给下一轮循环报告未结束
+			if l.peekEOF() || l.peekChar() == '\n' {
+				continue
+			}
+
+			escPos := l.pos()
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteRune('\n')
+			case 't':
+				out.WriteRune('\t')
+			case 'r':
+				out.WriteRune('\r')
+			case '"':
+				out.WriteRune('"')
+			case '\\':
+				out.WriteRune('\\')
+			case 'u':
+				r, msg := l.readUnicodeEscape()
+				if msg == "" {
+					out.WriteRune(r)
+				} else if ok {
+					l.addError(escPos, msg)
+					ok = false
+				}
+			default:
+				if ok {
+					l.addError(escPos, fmt.Sprintf("unknown escape sequence \\%c", l.ch))
+					ok = false
+				}
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// read the "{XXXX}" part of a \u{XXXX} escape, l.ch is the 'u'.
+// the closing quote and newlines are never consumed, msg is empty on success
+func (l *Lexer) readUnicodeEscape() (rune, string) {
+	if l.peekChar() != '{' {
+		return 0, "invalid unicode escape, want \\u{XXXX}"
+	}
+	l.readChar()
+
+	var value rune
+	digits := 0
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		value = value*16 + hexValue(l.ch)
+		digits++
+		if digits > 6 {
+			return 0, "unicode escape has more than 6 hex digits"
+		}
+	}
+
+	if l.peekChar() != '}' {
+		return 0, "invalid unicode escape, want \\u{XXXX}"
+	}
+	l.readChar()
+
+	if digits == 0 {
+		return 0, "empty unicode escape"
+	}
+	if !utf8.ValidRune(value) {
+		return 0, fmt.Sprintf("invalid unicode code point U+%X", value)
+	}
+
+	return value, ""
+}
+
+// read a number: decimal, 0x hexadecimal, 0o octal and 0b binary integers, and
+// decimal floats with a fraction and/or an exponent. '_' may separate digits.
+// a malformed number is returned as ILLEGAL with its raw source, only the first
+// problem is reported
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+	tokType := token.TokenType(token.INT)
+	var errPos token.Position
+	msg := ""
+
+	fail := func(pos token.Position, m string) {
+		if msg == "" {
+			errPos, msg = pos, m
+		}
+	}
+
+	base := 10
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	if base != 10 {
+		prefixPos := l.pos()
 		l.readChar()
+		l.readChar()
+		if l.readDigits(base, true, fail) == 0 {
+			fail(prefixPos, fmt.Sprintf("%s literal has no digits", baseName(base)))
+		}
+	} else {
+		l.readDigits(10, false, fail)
+
+		// 小数点后面必须是数字，否则'.'不属于这个数
+		if l.ch == '.' && isDigit(l.peekChar()) {
+			tokType = token.FLOAT
+			l.readChar()
+			l.readDigits(10, false, fail)
+		}
+
+		if l.ch == 'e' || l.ch == 'E' {
+			tokType = token.FLOAT
+			expPos := l.pos()
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			if l.readDigits(10, false, fail) == 0 {
+				fail(expPos, "exponent has no digits")
+			}
+		}
+	}
+
+	// 数字后面紧跟的字母也算在这个token里，比如0x1G
+	if isIdentifierChar(l.ch) {
+		fail(l.pos(), fmt.Sprintf("invalid character %q in %s literal", l.ch, baseName(base)))
+		for isIdentifierChar(l.ch) {
+			l.readChar()
+		}
 	}
 
-	return l.input[position : l.position]
+	literal := l.text(position, l.position)
+	if msg != "" {
+		l.addError(errPos, msg)
+		return token.ILLEGAL, literal
+	}
+	return tokType, literal
 }
 
-// check if the ch byte is a letter or not 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_';
+// readDigits reads the digits of a number in base and the '_' between them, it
+// returns the number of digits. a '_' may also follow a base prefix
+func (l *Lexer) readDigits(base int, afterPrefix bool, fail func(token.Position, string)) int {
+	digits := 0
+	prevUnderscore := false
+	var underscorePos token.Position
+
+	for isDigit(l.ch) || base == 16 && isHexDigit(l.ch) || l.ch == '_' {
+		if l.ch == '_' {
+			if digits == 0 && !afterPrefix || prevUnderscore {
+				fail(l.pos(), "'_' must separate successive digits")
+			}
+			prevUnderscore = true
+			underscorePos = l.pos()
+		} else {
+			if hexValue(l.ch) >= rune(base) {
+				fail(l.pos(), fmt.Sprintf("invalid digit %q in %s literal", l.ch, baseName(base)))
+			}
+			digits++
+			prevUnderscore = false
+		}
+		l.readChar()
+	}
+
+	if prevUnderscore {
+		fail(underscorePos, "'_' must separate successive digits")
+	}
+
+	return digits
+}
+
+func baseName(base int) string {
+	switch base {
+	case 16:
+		return "hexadecimal"
+	case 8:
+		return "octal"
+	case 2:
+		return "binary"
+	default:
+		return "decimal"
+	}
+}
+
+// check if the ch is a letter or not, any unicode letter can start an identifier
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// letters and unicode digits can follow the first letter of an identifier
+func isIdentifierChar(ch rune) bool {
+	return isLetter(ch) || isDigit(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
 }
 
-// check if the ch byte is a digit or not
-func isDigit(ch byte) bool {
+// check if the ch is an ascii digit or not, numbers are always ascii
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
+// skip whitespace and comments, the comments are returned as COMMENT tokens.
+// an unterminated block comment is returned as illegal
+func (l *Lexer) skipComments() ([]token.Token, *token.Token) {
+	var comments []token.Token
+
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments, nil
+		}
+
+		pos := l.pos()
+		if l.peekChar() == '/' {
+			l.readLineComment()
+		} else if !l.readBlockComment() {
+			l.addError(pos, "comment not terminated")
+			return comments, &token.Token{Type: token.ILLEGAL, Literal: l.text(pos.Offset, l.position), Pos: pos}
+		}
+
+		comments = append(comments, token.Token{Type: token.COMMENT, Literal: l.text(pos.Offset, l.position), Pos: pos, End: l.pos()})
+	}
+}
+
+// l.ch is the first '/', stops at the '\n' or EOF
+func (l *Lexer) readLineComment() {
+	for l.ch != '\n' && !l.atEOF {
+		l.readChar()
+	}
+}
+
+// l.ch is the '/' of "/*", block comments can be nested. stops after the
+// last "*/", return false if EOF comes first
+func (l *Lexer) readBlockComment() bool {
+	depth := 0
+
+	for !l.atEOF {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // skip the blank space 
 func (l *Lexer)skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
@@ -142,10 +630,14 @@ func (l *Lexer)skipWhitespace() {
 }
 
 // specially deal with the "==" | "!="
-func (l *Lexer)peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
-	} else {
-		return l.input[l.readPosition]
-	}
+func (l *Lexer)peekChar() rune {
+	ch, _ := l.runeAt(l.readPosition)
+	return ch
+}
+
+// peekEOF tells if the input ends after l.ch, peekChar gives 0 for the end
+// and for a NUL byte alike
+func (l *Lexer) peekEOF() bool {
+	_, width := l.runeAt(l.readPosition)
+	return width == 0
 }
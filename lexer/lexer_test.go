@@ -2,7 +2,13 @@ package lexer
 
 // be careful with monkey/token, the module is declared in go.mod
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
 	"monkey/token"
 )
 
@@ -13,7 +19,7 @@ func TestNextToken(t *testing.T) {
 	x + y;
 	};
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 	if (5 < 10) {
 	return true;
@@ -23,6 +29,13 @@ func TestNextToken(t *testing.T) {
 	
 	10 == 10;
 	10 != 9;	
+	a <= b >= c % d && e || f & g | h ^ ~i << j >> k;
+	x = y += 1 -= 2 *= 3 /= 4 %= h.k;
+	"foobar"
+	"foo bar"
+	[1, 2];
+	{"foo": "bar"}
+	while for in break continue
 	`
 	tests := []struct {
 		expectedType    token.TokenType
@@ -101,6 +114,63 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "g"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "h"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "i"},
+		{token.SHL, "<<"},
+		{token.IDENT, "j"},
+		{token.SHR, ">>"},
+		{token.IDENT, "k"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "y"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.IDENT, "h"},
+		{token.DOT, "."},
+		{token.IDENT, "k"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
 		{token.EOF, ""},
 	}
 
@@ -118,3 +188,443 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  x == 10;\n\n\tfn"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedOffset int
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 0, 1, 1},
+		{token.IDENT, 4, 1, 5},
+		{token.ASSIGN, 6, 1, 7},
+		{token.INT, 8, 1, 9},
+		{token.SEMICOLON, 9, 1, 10},
+		{token.IDENT, 13, 2, 3},
+		{token.EQ, 15, 2, 5},
+		{token.INT, 18, 2, 8},
+		{token.SEMICOLON, 20, 2, 10},
+		{token.FUNCTION, 24, 4, 2},
+		{token.EOF, 26, 4, 4},
+	}
+
+	l := NewFile("main.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Filename != "main.mk" {
+			t.Fatalf("tests[%d] - filename wrong. expected=%q, got=%q", i, "main.mk", tok.Pos.Filename)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset || tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d (offset %d), got=%d:%d (offset %d)", i,
+				tt.expectedLine, tt.expectedColumn, tt.expectedOffset,
+				tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset)
+		}
+	}
+
+	if got := (token.Position{Filename: "main.mk", Line: 2, Column: 3}).String(); got != "main.mk:2:3" {
+		t.Fatalf("Position.String() wrong. expected=%q, got=%q", "main.mk:2:3", got)
+	}
+}
+
+// the source text of a token is [Pos, End), the Literal may differ from it
+func TestTokenEnd(t *testing.T) {
+	input := "\"a\\tb\" 中文 /* c */ <= 0x1F\n"
+	expected := []string{`"a\tb"`, "中文", "<=", "0x1F", ""}
+
+	l := New(input)
+	l.SetMode(ScanComments)
+	for i, text := range expected {
+		tok := l.NextToken()
+		if got := input[tok.Pos.Offset:tok.End.Offset]; got != text {
+			t.Fatalf("tests[%d] - source text wrong. expected=%q, got=%q", i, text, got)
+		}
+		if tok.End.RuneColumn-tok.Pos.RuneColumn != utf8.RuneCountInString(text) {
+			t.Fatalf("tests[%d] - end column wrong. got=%d-%d", i, tok.Pos.RuneColumn, tok.End.RuneColumn)
+		}
+		for _, c := range tok.Comments {
+			if input[c.Pos.Offset:c.End.Offset] != c.Literal {
+				t.Fatalf("tests[%d] - comment text wrong. got=%q", i, input[c.Pos.Offset:c.End.Offset])
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc", ""},
+		{`"say \"hi\""`, token.STRING, `say "hi"`, ""},
+		{`"back\\slash"`, token.STRING, `back\slash`, ""},
+		{`"\u{48}\u{4e2d}\u{1F600}"`, token.STRING, "H中😀", ""},
+		{`"中文"`, token.STRING, "中文", ""},
+		{`""`, token.STRING, "", ""},
+		{`"abc`, token.ILLEGAL, `"abc`, "1:5: string literal not terminated"},
+		{"\"abc\nlet", token.ILLEGAL, `"abc`, "1:5: string literal not terminated"},
+		{`"abc\`, token.ILLEGAL, `"abc\`, "1:6: string literal not terminated"},
+		{"\"a\x00b\"", token.STRING, "a\x00b", ""},
+		{"\"a\\\x00\"", token.ILLEGAL, "\"a\\\x00\"", "1:3: unknown escape sequence \\\x00"},
+		{"\"a\x00", token.ILLEGAL, "\"a\x00", "1:4: string literal not terminated"},
+		{`"a\qb"`, token.ILLEGAL, `"a\qb"`, "1:3: unknown escape sequence \\q"},
+		{`"\u48"`, token.ILLEGAL, `"\u48"`, "1:2: invalid unicode escape, want \\u{XXXX}"},
+		{`"\u{}"`, token.ILLEGAL, `"\u{}"`, "1:2: empty unicode escape"},
+		{`"\u{D800}"`, token.ILLEGAL, `"\u{D800}"`, "1:2: invalid unicode code point U+D800"},
+		{`"\u{1234567}"`, token.ILLEGAL, `"\u{1234567}"`, "1:2: unicode escape has more than 6 hex digits"},
+		{`"\x \y"`, token.ILLEGAL, `"\x \y"`, "1:2: unknown escape sequence \\x"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Fatalf("tests[%d] - unexpected errors %v", i, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || errors[0].Error() != tt.expectedError {
+			t.Fatalf("tests[%d] - errors wrong. expected=[%s], got=%v", i, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still comment */ x / 2
+/**/ y
+// last`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing", "/* block /* nested */ still comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.IDENT, "y", []string{"/**/"}},
+		{token.EOF, "", []string{"// last"}},
+	}
+
+	for _, mode := range []Mode{0, ScanComments} {
+		l := New(input)
+		l.SetMode(mode)
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+
+			expected := tt.expectedComments
+			if mode == 0 {
+				expected = nil
+			}
+			if len(tok.Comments) != len(expected) {
+				t.Fatalf("tests[%d] - comments wrong. expected=%q, got=%v", i, expected, tok.Comments)
+			}
+			for j, c := range tok.Comments {
+				if c.Type != token.COMMENT || c.Literal != expected[j] {
+					t.Fatalf("tests[%d] - comments[%d] wrong. expected=%q, got=%q", i, j, expected[j], c.Literal)
+				}
+			}
+		}
+	}
+
+	l := New("x /* open /* nested */")
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/* open /* nested */" {
+		t.Fatalf("unterminated comment wrong. got=%q %q", tok.Type, tok.Literal)
+	}
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "1:3: comment not terminated" {
+		t.Fatalf("errors wrong. got=%v", l.Errors())
+	}
+
+	// NUL字节不是输入的结尾
+	l = New("/* a \x00 b */ x // c \x00 d\ny")
+	l.SetMode(ScanComments)
+	for _, expected := range []struct {
+		literal  string
+		comments []string
+	}{
+		{"x", []string{"/* a \x00 b */"}},
+		{"y", []string{"// c \x00 d"}},
+		{"", nil},
+	} {
+		tok := l.NextToken()
+		if tok.Literal != expected.literal || len(tok.Comments) != len(expected.comments) {
+			t.Fatalf("comment with NUL wrong. got=%q %v", tok.Literal, tok.Comments)
+		}
+		for j, c := range tok.Comments {
+			if c.Literal != expected.comments[j] {
+				t.Fatalf("comment with NUL wrong. expected=%q, got=%q", expected.comments[j], c.Literal)
+			}
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Fatalf("comment with NUL has errors %v", l.Errors())
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let 数量 = café + x1_٣;\n\"中文\" 数量 \xff"
+
+	tests := []struct {
+		expectedType       token.TokenType
+		expectedLiteral    string
+		expectedColumn     int
+		expectedRuneColumn int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "数量", 5, 5},
+		{token.ASSIGN, "=", 12, 8},
+		{token.IDENT, "café", 14, 10},
+		{token.PLUS, "+", 20, 15},
+		{token.IDENT, "x1_٣", 22, 17},
+		{token.SEMICOLON, ";", 27, 21},
+		{token.STRING, "中文", 1, 1},
+		{token.IDENT, "数量", 10, 6},
+		{token.ILLEGAL, "\xff", 17, 9},
+		{token.EOF, "", 18, 10},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn || tok.Pos.RuneColumn != tt.expectedRuneColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d (rune %d), got=%d (rune %d)", i,
+				tt.expectedColumn, tt.expectedRuneColumn, tok.Pos.Column, tok.Pos.RuneColumn)
+		}
+	}
+
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "2:17: invalid UTF-8 encoding" {
+		t.Fatalf("errors wrong. got=%v", l.Errors())
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	unit := `let 数量 = fn(x, y) { x + y; }; // comment
+	/* block
+	   comment */ let s = "esc\t\u{4e2d}" [1, 2][0]; "bad \q" @
+	`
+	input := strings.Repeat(unit, 2000)
+
+	want := New(input)
+	want.SetMode(ScanComments)
+	got := NewReader(iotest.OneByteReader(strings.NewReader(input)))
+	got.SetMode(ScanComments)
+
+	for i := 0; ; i++ {
+		expected := want.NextToken()
+		tok := got.NextToken()
+
+		if tok.Type != expected.Type || tok.Literal != expected.Literal || tok.Pos != expected.Pos ||
+			len(tok.Comments) != len(expected.Comments) {
+			t.Fatalf("token %d wrong. expected=%+v, got=%+v", i, expected, tok)
+		}
+
+		// 只缓存当前的token
+		if cap(got.buf) > 4*chunkSize {
+			t.Fatalf("token %d - buffer grew to %d bytes", i, cap(got.buf))
+		}
+
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	if len(got.Errors()) != len(want.Errors()) {
+		t.Fatalf("errors wrong. expected=%d errors, got=%d", len(want.Errors()), len(got.Errors()))
+	}
+}
+
+// the tokens of a line come out as soon as the line is written, the lexer
+// doesn't wait for more input, like in the REPL
+func TestNewReaderPipe(t *testing.T) {
+	lines := []struct {
+		line     string
+		expected []token.TokenType
+	}{
+		{"let x = 1;\n", []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON}},
+		{"\"中\" + x\n", []token.TokenType{token.STRING, token.PLUS, token.IDENT}},
+		{"}\n", []token.TokenType{token.RBRACE}},
+	}
+
+	r, w := io.Pipe()
+	write := make(chan string)
+	go func() {
+		for line := range write {
+			w.Write([]byte(line))
+		}
+		w.Close()
+	}()
+
+	tokens := make(chan token.Token)
+	go func() {
+		l := NewReader(r)
+		for {
+			tok := l.NextToken()
+			tokens <- tok
+			if tok.Type == token.EOF {
+				return
+			}
+		}
+	}()
+
+	next := func() token.Token {
+		select {
+		case tok := <-tokens:
+			return tok
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lexer blocked waiting for more input")
+			return token.Token{}
+		}
+	}
+
+	for _, tt := range lines {
+		write <- tt.line
+		for _, expected := range tt.expected {
+			if tok := next(); tok.Type != expected {
+				t.Fatalf("after %q - tokentype wrong. expected=%q, got=%q", tt.line, expected, tok.Type)
+			}
+		}
+	}
+
+	close(write)
+	if tok := next(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestNewReaderError(t *testing.T) {
+	r := iotest.DataErrReader(iotest.TimeoutReader(strings.NewReader("let x = 5;")))
+	l := NewReader(r)
+
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.ILLEGAL, token.EOF, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+
+	if len(l.Errors()) != 1 || !strings.Contains(l.Errors()[0].Msg, "read error") {
+		t.Fatalf("errors wrong. got=%v", l.Errors())
+	}
+
+	l = NewReader(iotest.ErrReader(errors.New("broken pipe")))
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL || l.Errors()[0].Error() != "1:1: read error: broken pipe" {
+		t.Fatalf("read error wrong. got=%q %v", tok.Type, l.Errors())
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0", token.INT, "0", ""},
+		{"42", token.INT, "42", ""},
+		{"007", token.INT, "007", ""},
+		{"0_10", token.INT, "0_10", ""},
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"0x1F", token.INT, "0x1F", ""},
+		{"0Xdead_BEEF", token.INT, "0Xdead_BEEF", ""},
+		{"0x_1f", token.INT, "0x_1f", ""},
+		{"0o17", token.INT, "0o17", ""},
+		{"0b1010", token.INT, "0b1010", ""},
+		{"3.14", token.FLOAT, "3.14", ""},
+		{"0.5", token.FLOAT, "0.5", ""},
+		{"1e-9", token.FLOAT, "1e-9", ""},
+		{"6.022E+23", token.FLOAT, "6.022E+23", ""},
+		{"1_0.2_5e1_0", token.FLOAT, "1_0.2_5e1_0", ""},
+		{"0x", token.ILLEGAL, "0x", "1:1: hexadecimal literal has no digits"},
+		{"0b", token.ILLEGAL, "0b", "1:1: binary literal has no digits"},
+		{"1__0", token.ILLEGAL, "1__0", "1:3: '_' must separate successive digits"},
+		{"10_", token.ILLEGAL, "10_", "1:3: '_' must separate successive digits"},
+		{"0b102", token.ILLEGAL, "0b102", "1:5: invalid digit '2' in binary literal"},
+		{"0o8", token.ILLEGAL, "0o8", "1:3: invalid digit '8' in octal literal"},
+		{"0x1G", token.ILLEGAL, "0x1G", "1:4: invalid character 'G' in hexadecimal literal"},
+		{"12abc", token.ILLEGAL, "12abc", "1:3: invalid character 'a' in decimal literal"},
+		{"1e", token.ILLEGAL, "1e", "1:2: exponent has no digits"},
+		{"1e+", token.ILLEGAL, "1e+", "1:2: exponent has no digits"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedError == "" {
+			if len(l.Errors()) != 0 {
+				t.Fatalf("tests[%d] - unexpected errors %v", i, l.Errors())
+			}
+		} else if len(l.Errors()) != 1 || l.Errors()[0].Error() != tt.expectedError {
+			t.Fatalf("tests[%d] - errors wrong. expected=[%s], got=%v", i, tt.expectedError, l.Errors())
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("tests[%d] - number not fully read, next token %q", i, tok.Literal)
+		}
+	}
+
+	// '.'后面不是数字时不属于这个数
+	l := New("1.x")
+	for _, expected := range []string{"1", ".", "x"} {
+		if tok := l.NextToken(); tok.Literal != expected {
+			t.Fatalf("literal wrong. expected=%q, got=%q", expected, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package lexer
+
+import "unicode/utf8"
+
+// ===================== 输入缓冲 ================
+// the lexer reads its input in chunks, buf holds the bytes from offset base on.
+// everything before the current token is discarded, so only one token (plus the
+// lookahead) has to fit in memory
+
+const chunkSize = 4096
+
+// fill reads until the buffer holds a whole rune at offset, or the input ends.
+// it never asks for more, on a pipe or a terminal the next bytes may not be
+// written yet
+func (l *Lexer) fill(offset int) {
+	for l.readErr == nil && (offset-l.base >= len(l.buf) || !utf8.FullRune(l.buf[offset-l.base:])) {
+		if len(l.buf) == cap(l.buf) {
+			buf := make([]byte, len(l.buf), 2*len(l.buf)+chunkSize)
+			copy(buf, l.buf)
+			l.buf = buf
+		}
+
+		m, err := l.src.Read(l.buf[len(l.buf):cap(l.buf)])
+		l.buf = l.buf[:len(l.buf)+m]
+		if err != nil {
+			l.readErr = err
+		}
+	}
+}
+
+// runeAt decodes the rune at offset, width is 0 at the end of the input
+func (l *Lexer) runeAt(offset int) (rune, int) {
+	l.fill(offset)
+
+	i := offset - l.base
+	if i >= len(l.buf) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(l.buf[i:])
+}
+
+// text returns the input between the offsets [start, end), which must not be discarded yet
+func (l *Lexer) text(start int, end int) string {
+	return string(l.buf[start-l.base : end-l.base])
+}
+
+// discard drops the bytes before offset
+func (l *Lexer) discard(offset int) {
+	if n := offset - l.base; n > 0 {
+		l.buf = l.buf[n:]
+		l.base = offset
+	}
+}
@@ -8,6 +8,16 @@ import (
 )
 
 func main() {
+	// 带参数时执行子命令，否则进入REPL
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if !ok {
+			usage(os.Stderr)
+			os.Exit(2)
+		}
+		os.Exit(cmd.run(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"sort"
+	"unicode/utf8"
+)
+
+// ===================== 诊断信息 ================
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	switch name {
+	case "error":
+		*s = SeverityError
+	case "warning":
+		*s = SeverityWarning
+	default:
+		return fmt.Errorf("unknown severity %q", name)
+	}
+	return nil
+}
+
+// diagnostic codes, stable so that tools can match on them
+const (
+	CodeUnexpectedToken = "unexpected-token"
+	CodeNoPrefixParseFn = "no-prefix-parse-fn"
+	CodeInvalidInteger  = "invalid-integer"
+	CodeInvalidFloat    = "invalid-float"
+	CodeIllegalToken    = "illegal-token"
+	CodeInvalidAssign   = "invalid-assignment"
+	CodeOutsideLoop     = "outside-loop"
+)
+
+// Span is the source range [Start, End) a diagnostic refers to
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// Diagnostic is one problem found while parsing
+type Diagnostic struct {
+	Severity Severity          `json:"severity"`
+	Span     Span              `json:"span"`
+	Code     string            `json:"code"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Found    token.TokenType   `json:"found,omitempty"`
+	Message  string            `json:"message"`
+}
+
+// Error renders the diagnostic as "file:line:column: severity: message"
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+}
+
+// ErrorList is the list of diagnostics of a parse, it implements error
+type ErrorList []*Diagnostic
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ErrorList) Less(i, j int) bool {
+	a, b := l[i].Span.Start, l[j].Span.Start
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Offset < b.Offset
+}
+
+// Sort sorts the list by position, diagnostics at the same position keep their order
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil for an empty list, so that callers can write `if err := p.Errors().Err(); err != nil`
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Text renders every diagnostic on its own line
+func (l ErrorList) Text() string {
+	var out bytes.Buffer
+
+	for _, d := range l {
+		out.WriteString(d.Error())
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// JSON renders the list as a json array, an empty list is "[]"
+func (l ErrorList) JSON() ([]byte, error) {
+	if l == nil {
+		l = ErrorList{}
+	}
+	return json.Marshal(l)
+}
+
+// span of a single token, from the source text of the token: the Literal of a
+// string has no quotes and its escapes are decoded
+func tokenSpan(tok token.Token) Span {
+	if tok.End.IsValid() {
+		return Span{Start: tok.Pos, End: tok.End}
+	}
+
+	// 手写的token没有End
+	end := tok.Pos
+	if end.IsValid() {
+		end.Offset += len(tok.Literal)
+		end.Column += len(tok.Literal)
+		end.RuneColumn += utf8.RuneCountInString(tok.Literal)
+	}
+	return Span{Start: tok.Pos, End: end}
+}
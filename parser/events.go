@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"strings"
+)
+
+// ===================== 语法树事件 ================
+// Mode controls what the parser records besides the ast
+type Mode uint
+
+const (
+	RecordEvents Mode = 1 << iota // record the Events, package cst builds its tree from them
+)
+
+// SetMode changes the mode, call it before ParseProgram
+func (p *Parser) SetMode(mode Mode) {
+	p.mode = mode
+}
+
+// NodeKind names a node of the syntax tree: the type of the ast node the parser
+// built for it, like "LetStatement", or one of the kinds below for the parts of
+// the source that have no ast node of their own
+type NodeKind string
+
+const (
+	ParenExpression NodeKind = "ParenExpression" // ( expression )
+	ParameterList   NodeKind = "ParameterList"   // (a, b) of a function literal
+	ArgumentList    NodeKind = "ArgumentList"    // (1, 2) of a call
+	HashPair        NodeKind = "HashPair"        // key: value
+)
+
+func kindOf(node ast.Node) NodeKind {
+	return NodeKind(strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+}
+
+type EventType int
+
+const (
+	EventStart  EventType = iota // a node starts, the events up to the matching EventFinish are its children
+	EventToken                   // a token, in source order, every token of the input appears once
+	EventFinish                  // the last node started is complete
+)
+
+// Event is a step of the parse. Nested EventStart and EventFinish give the
+// shape of the tree, the EventTokens between them its leaves
+type Event struct {
+	Type  EventType
+	Kind  NodeKind    // for EventFinish, the kind of the node
+	Token token.Token // for EventToken
+
+	opens int // for EventStart, the number of nodes starting here, see precede
+}
+
+// Events returns what the parser recorded in RecordEvents mode
+func (p *Parser) Events() []Event {
+	events := make([]Event, 0, len(p.events))
+	for _, e := range p.events {
+		if e.Type != EventStart {
+			events = append(events, e)
+			continue
+		}
+		for i := 0; i < e.opens; i++ {
+			events = append(events, Event{Type: EventStart})
+		}
+	}
+	return events
+}
+
+func (p *Parser) recording() bool { return p.mode&RecordEvents != 0 }
+
+// eat records curToken, once. A token is recorded when the parser moves past it
+// or when the node it ends is finished, so that a node started before the
+// token gets it
+func (p *Parser) eat() {
+	if p.eaten {
+		return
+	}
+	p.eaten = true
+
+	if p.recording() {
+		p.events = append(p.events, Event{Type: EventToken, Token: p.curToken})
+	}
+}
+
+// start opens a node at curToken, or right after it if it is eaten already.
+// The mark it returns lets precede wrap the node in another one
+func (p *Parser) start() int {
+	if !p.recording() {
+		return -1
+	}
+	p.events = append(p.events, Event{Type: EventStart, opens: 1})
+	return len(p.events) - 1
+}
+
+// precede opens one more node at mark, around the one started there. The
+// Pratt loop needs it: the left operand is parsed before the parser knows it
+// is the left operand of an infix expression
+func (p *Parser) precede(mark int) {
+	if mark >= 0 {
+		p.events[mark].opens++
+	}
+}
+
+// finish closes the last node opened, curToken is its last token. EOF is
+// left for the program, see ParseProgram
+func (p *Parser) finish(kind NodeKind) {
+	if !p.curTokenIs(token.EOF) {
+		p.eat()
+	}
+	if p.recording() {
+		p.events = append(p.events, Event{Type: EventFinish, Kind: kind})
+	}
+}
+
+// leaf makes a node of curToken alone, e.g. the Identifier of a let
+func (p *Parser) leaf(kind NodeKind) {
+	p.start()
+	p.finish(kind)
+}
+
+// missing records an empty node where the parser found no expression, after
+// curToken which belongs to the enclosing node
+func (p *Parser) missing() {
+	if !p.curTokenIs(token.EOF) {
+		p.eat()
+	}
+	p.leaf(kindOf(&ast.BadExpression{}))
+}
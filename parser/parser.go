@@ -6,30 +6,68 @@ import (
 	"monkey/token"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // ===================== 定义parser的优先级 ================
+// 和C语言的优先级顺序一致
 const (
 	_ int = iota
 
 	LOWEST
+	ASSIGN      // = or +=, right associative
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X	) 
+	INDEX       // array[index]
 )
 
 var precedencs = map[token.TokenType] int {
+	token.ASSIGN: ASSIGN,
+	token.PLUS_ASSIGN: ASSIGN,
+	token.MINUS_ASSIGN: ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN: ASSIGN,
+	token.PERCENT_ASSIGN: ASSIGN,
+	token.OR:     LOGICAL_OR,
+	token.AND:    LOGICAL_AND,
+	token.BIT_OR: BIT_OR,
+	token.BIT_XOR: BIT_XOR,
+	token.BIT_AND: BIT_AND,
 	token.EQ:    EQUALS,
 	token.NOT_EQ: EQUALS,
 	token.LT:     LESSGREATER,
 	token.GT:     LESSGREATER,
+	token.LT_EQ:  LESSGREATER,
+	token.GT_EQ:  LESSGREATER,
+	token.SHL:    SHIFT,
+	token.SHR:    SHIFT,
 	token.PLUS:   SUM,
 	token.MINUS:  SUM,
 	token.SLASH:  PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT: PRODUCT,
+	token.LPAREN: CALL,
+	token.LBRACKET: INDEX,
+	token.DOT: INDEX,
+}
+
+// Precedence returns the binding power of the infix operator t, LOWEST if t is not
+// one. The formatter uses it to decide where parentheses are needed
+func Precedence(t token.TokenType) int {
+	if p, ok := precedencs[t]; ok {
+		return p
+	}
+	return LOWEST
 }
 
 // ====================== 定义parser类 =====================
@@ -39,7 +77,15 @@ type Parser struct {
 	curToken token.Token
 	peekToken token.Token
 
-	errors []string
+	errors ErrorList
+	panicking bool    // an error was reported in the current statement, wait for synchronize
+	depth int         // number of '{' not closed yet, up to curToken
+	stmtDepth int     // depth before the first token of the current statement
+	loopDepth int     // number of enclosing loop bodies, reset inside a function literal
+
+	mode Mode
+	events []Event    // see events.go
+	eaten bool        // curToken is recorded already
 
 	prefixParseFn map[token.TokenType]prefixParseFn
 	infixParseFn map[token.TokenType]infixParseFn
@@ -48,7 +94,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	// 用lexer做初始化parser
 	p := &Parser{l : l, 
-		         errors : []string{},}		
+		         errors : ErrorList{},}		
 
 	// 先读取两个token，已初始化curToken和peekToken
 	p.nextToken()
@@ -58,8 +104,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFn = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
+	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFn = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -70,6 +127,25 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	return p
 }
 
@@ -80,17 +156,70 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	value, err := IntegerValue(p.curToken.Literal)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.addError(p.curToken, CodeInvalidInteger, msg)
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// IntegerValue reads an INT literal as the lexer returned it. without a base
+// prefix it is decimal, leading zeros don't make it octal: 007 is 7
+func IntegerValue(literal string) (int64, error) {
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXoObB", rune(literal[1])) {
+		return strconv.ParseInt(literal, 0, 64)
+	}
+
+	return strconv.ParseInt(strings.ReplaceAll(literal, "_", ""), 10, 64)
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	// ParseFloat只接受带前缀的数字里的'_'
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.addError(p.curToken, CodeInvalidFloat, msg)
+		return &ast.BadExpression{Token: p.curToken}
 	}
 
 	lit.Value = value
 	return lit
 }
 
+// the lexer already knows what is wrong with an ILLEGAL token, report its message
+func (p *Parser) parseIllegal() ast.Expression {
+	tok := p.curToken
+	msg := fmt.Sprintf("illegal token %q", tok.Literal)
+	span := tokenSpan(tok)
+
+	for _, e := range p.l.Errors() {
+		if e.Pos.Offset >= span.Start.Offset && e.Pos.Offset <= span.End.Offset {
+			msg = e.Msg
+			span.Start = e.Pos
+			break
+		}
+	}
+
+	d := p.addError(tok, CodeIllegalToken, msg)
+	d.Span.Start = span.Start
+
+	return &ast.BadExpression{Token: tok}
+}
+
+func (p *Parser) parseBooleanLiteral() ast.Expression {
+	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn func(ast.Expression) ast.Expression
@@ -99,8 +228,24 @@ type (
 // ====================================== helper function ==================================
 // 获取下一个token
 func (p *Parser)nextToken() {
+	// EOF之后不再前进，第一个EOF带着文件末尾的注释
+	if p.curTokenIs(token.EOF) {
+		return
+	}
+
+	p.eat()
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()	
+	p.eaten = false
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 }
 
 func (p *Parser)curTokenIs(t token.TokenType) bool{
@@ -138,13 +283,35 @@ func (p *Parser)curPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser)Errors() []string {
+// Errors returns the diagnostics sorted by position
+func (p *Parser)Errors() ErrorList {
+	p.errors.Sort()
 	return p.errors
 }
 
+// addError records a diagnostic, errors following the first one of a statement are
+// most likely caused by it, so they are dropped until the parser synchronizes
+func (p *Parser) addError(tok token.Token, code string, msg string) *Diagnostic {
+	if p.panicking {
+		return &Diagnostic{}
+	}
+	p.panicking = true
+
+	d := &Diagnostic{
+		Severity: SeverityError,
+		Span: tokenSpan(tok),
+		Code: code,
+		Found: tok.Type,
+		Message: msg,
+	}
+	p.errors = append(p.errors, d)
+	return d
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.addError(p.peekToken, CodeUnexpectedToken, msg)
+	d.Expected = []token.TokenType{t}
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -161,6 +328,7 @@ func (p *Parser)ParseProgram() *ast.Program {
 	// 初始化空的statement
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
+	p.start()
 
 	// 遍历token，直到EOF
 	for p.curToken.Type != token.EOF {
@@ -172,16 +340,30 @@ func (p *Parser)ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	p.eat()
+	p.finish(kindOf(program))
 	return program
 }
 
 func (p *Parser)parseExpression(precedence int) ast.Expression {
+	mark := p.start()
+
 	prefix := p.prefixParseFn[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		p.noPrefixParseFnError(p.curToken)
+		bad := &ast.BadExpression{Token: p.curToken}
+		p.finish(kindOf(bad))
+		return bad
 	}
+
+	paren := p.curTokenIs(token.LPAREN)
 	leftExp := prefix()
+	kind := kindOf(leftExp)
+	// 括号没有自己的ast节点
+	if paren && kind != kindOf(&ast.BadExpression{}) {
+		kind = ParenExpression
+	}
+	p.finish(kind)
 
 	// 在parse infix的时候，需要使用precedence来判断优先级
 	for !p.curTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
@@ -191,12 +373,28 @@ func (p *Parser)parseExpression(precedence int) ast.Expression {
 		}
 
 		p.nextToken()	
+		p.precede(mark)
 		leftExp = infix(leftExp)
+		p.finish(kindOf(leftExp))
 	}
 
 	return leftExp
 }
 
+// parseNextExpression parses the expression starting at peekToken. when peekToken
+// can't start an expression (e.g. the ')' in "(1 + )") the parser doesn't move,
+// so a closing delimiter is left for its owner
+func (p *Parser)parseNextExpression(precedence int) ast.Expression {
+	if p.prefixParseFn[p.peekToken.Type] == nil {
+		p.noPrefixParseFnError(p.peekToken)
+		p.missing()
+		return &ast.BadExpression{Token: p.peekToken}
+	}
+
+	p.nextToken()
+	return p.parseExpression(precedence)
+}
+
 func (p *Parser)parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -211,60 +409,249 @@ func (p *Parser)parseExpressionStatement() *ast.ExpressionStatement {
 
 // parse Statement ast树结构
 func (p *Parser)parseStatement() ast.Statement {
+	var stmt ast.Statement
+
+	// 记录statement开始时的花括号深度，synchronize需要回到这个深度
+	outer := p.stmtDepth
+	p.stmtDepth = p.depth
+	if p.curTokenIs(token.LBRACE) {
+		p.stmtDepth--
+	}
+	defer func() { p.stmtDepth = outer }()
+
+	p.start()
+
 	// 判断是否是let statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.WHILE:
+		stmt = p.parseWhileStatement()
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseBranchStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	// 出错之后跳过剩余的token，从下一个statement重新开始
+	if p.panicking {
+		p.synchronize()
+		p.panicking = false
 	}
+
+	// 跳过的token也属于这个statement
+	p.finish(kindOf(stmt))
+	return stmt
 }
 
-func (p *Parser)parseLetStatement() *ast.LetStatement {
+// synchronize skips tokens until the end of the broken statement: curToken stops
+// on a ';' or right before '}', let, return, fn, while, for or EOF, but only once
+// every '{' opened inside the statement has been closed
+func (p *Parser)synchronize() {
+	for !p.curTokenIs(token.EOF) {
+		if p.depth == p.stmtDepth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.RETURN, token.FUNCTION, token.WHILE, token.FOR, token.EOF:
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// badStatement is returned when a statement is too broken to build its node
+func (p *Parser)badStatement(start token.Token) *ast.BadStatement {
+	p.synchronize()
+	return &ast.BadStatement{Token: start, End: p.curToken.Pos}
+}
+
+func (p *Parser)parseLetStatement() ast.Statement {
 	// 初始化let statement
 	letStmt := &ast.LetStatement{Token: p.curToken}
 
 	// 判断curToken是否是Let
 	if !p.expectPeek(token.IDENT) {
-		return nil
+		return p.badStatement(letStmt.Token)
 	}
 	
 	letStmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.leaf(kindOf(letStmt.Name))
 
 	if !p.expectPeek(token.ASSIGN) {
-		return nil
+		return p.badStatement(letStmt.Token)
 	}
 	
-	// not deal with expression here
-	for !p.curTokenIs(token.SEMICOLON) {
+	letStmt.Value = p.parseNextExpression(LOWEST)
+
+	// 分号是可选的
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	
 	return letStmt
 }
 
-func (p *Parser)parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser)parseReturnStatement() ast.Statement {
 	returnStmt := &ast.ReturnStatement{Token: p.curToken}
 
-	p.nextToken()
-	
-	for !p.curTokenIs(token.SEMICOLON) { 
+	// 裸的return没有返回值
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return returnStmt
+	}
+
+	returnStmt.ReturnValue = p.parseNextExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return returnStmt
 }
 
+// ===================== 循环 ================
+// curToken is the '{' of the loop body
+func (p *Parser)parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	// 分号是可选的
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
+
+func (p *Parser)parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return p.badStatement(stmt.Token)
+	}
+
+	stmt.Condition = p.parseNextExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return p.badStatement(stmt.Token)
+	}
+
+	stmt.Body = p.parseLoopBody()
+	return stmt
+}
+
+// parseForStatement parses both "for (init; cond; update) {}" and "for (x in xs) {}",
+// they only differ after the first identifier
+func (p *Parser)parseForStatement() ast.Statement {
+	start := p.curToken
+
+	if !p.expectPeek(token.LPAREN) {
+		return p.badStatement(start)
+	}
+
+	stmt := &ast.ForStatement{Token: start}
+
+	// init语句自己会吃掉结尾的分号
+	switch p.peekToken.Type {
+	case token.SEMICOLON:
+		p.nextToken()
+	case token.LET:
+		p.nextToken()
+		p.start()
+		stmt.Init = p.parseLetStatement()
+		p.finish(kindOf(stmt.Init))
+	default:
+		if p.prefixParseFn[p.peekToken.Type] == nil {
+			p.noPrefixParseFnError(p.peekToken)
+			return p.badStatement(start)
+		}
+		p.nextToken()
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IN) {
+			return p.parseForInStatement(start)
+		}
+		p.start()
+		stmt.Init = p.parseExpressionStatement()
+		p.finish(kindOf(stmt.Init))
+	}
+
+	if !p.curTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+		return p.badStatement(start)
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseNextExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return p.badStatement(start)
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		stmt.Update = p.parseNextExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return p.badStatement(start)
+	}
+
+	stmt.Body = p.parseLoopBody()
+	return stmt
+}
+
+// curToken is the loop variable, peekToken is 'in'
+func (p *Parser)parseForInStatement(start token.Token) ast.Statement {
+	stmt := &ast.ForInStatement{Token: start}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.leaf(kindOf(stmt.Variable))
+
+	p.nextToken()
+	stmt.Iterable = p.parseNextExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return p.badStatement(start)
+	}
+
+	stmt.Body = p.parseLoopBody()
+	return stmt
+}
+
+// parseBranchStatement parses break and continue, only allowed inside a loop body
+func (p *Parser)parseBranchStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s is not in a loop", p.curToken.Literal)
+		p.addError(p.curToken, CodeOutsideLoop, msg)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token: p.curToken,
 		Operator: p.curToken.Literal,
 	}
 
-	p.nextToken()
-	expression.Right = p.parseExpression(PREFIX)
+	expression.Right = p.parseNextExpression(PREFIX)
 	return expression
 }
 
@@ -276,14 +663,276 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
-	p.nextToken()
-	expression.Right = p.parseExpression(precedence)
+	expression.Right = p.parseNextExpression(precedence)
 	
 	return expression
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	exp := p.parseNextExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	return exp
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return &ast.BadExpression{Token: expression.Token}
+	}
+
+	expression.Condition = p.parseNextExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return &ast.BadExpression{Token: expression.Token}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return &ast.BadExpression{Token: expression.Token}
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	// else分支是可选的
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return &ast.BadExpression{Token: expression.Token}
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// curToken is the '{', stops on the matching '}'
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+	p.start()
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	if !p.curTokenIs(token.RBRACE) {
+		msg := fmt.Sprintf("expected } to close the block at %s, got %s instead", block.Token.Pos, p.curToken.Type)
+		d := p.addError(p.curToken, CodeUnexpectedToken, msg)
+		d.Expected = []token.TokenType{token.RBRACE}
+	}
+
+	p.finish(kindOf(block))
+	return block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return &ast.BadExpression{Token: lit.Token}
+	}
+
+	params, ok := p.parseFunctionParameters()
+	if !ok {
+		return &ast.BadExpression{Token: lit.Token}
+	}
+	lit.Parameters = params
+
+	if !p.expectPeek(token.LBRACE) {
+		return &ast.BadExpression{Token: lit.Token}
+	}
+
+	// break和continue不能跳出函数体
+	outer := p.loopDepth
+	p.loopDepth = 0
+	lit.Body = p.parseBlockStatement()
+	p.loopDepth = outer
+
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() (ast.IdentifierList, bool) {
+	identifiers := ast.IdentifierList{}
+	p.start()
+	defer p.finish(ParameterList)
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers, true
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, false
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	p.leaf(kindOf(identifiers[len(identifiers)-1]))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil, false
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		p.leaf(kindOf(identifiers[len(identifiers)-1]))
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, false
+	}
+
+	return identifiers, true
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+
+	p.start()
+	args, ok := p.parseExpressionList(token.RPAREN)
+	p.finish(ArgumentList)
+	if !ok {
+		return &ast.BadExpression{Token: exp.Token}
+	}
+	exp.Arguments = args
+
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+
+	elements, ok := p.parseExpressionList(token.RBRACKET)
+	if !ok {
+		return &ast.BadExpression{Token: array.Token}
+	}
+	array.Elements = elements
+
+	return array
+}
+
+// parse comma separated expressions until end, used by call arguments and array literal
+func (p *Parser) parseExpressionList(end token.TokenType) ([]ast.Expression, bool) {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list, true
+	}
+
+	list = append(list, p.parseNextExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		list = append(list, p.parseNextExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil, false
+	}
+
+	return list, true
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	exp.Index = p.parseNextExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return &ast.BadExpression{Token: exp.Token}
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return &ast.BadExpression{Token: exp.Token}
+	}
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.leaf(kindOf(exp.Property))
+
+	return exp
+}
+
+// 赋值是右结合的：a = b = c 是 a = (b = c)
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{
+		Token: p.curToken,
+		Target: target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.MemberExpression:
+	case *ast.BadExpression:
+		// 已经报过错了
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", target.String())
+		p.addError(p.curToken, CodeInvalidAssign, msg)
+	}
+
+	exp.Value = p.parseNextExpression(ASSIGN - 1)
+
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Keys = []ast.Expression{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		// pair从'{'或者','之后开始
+		p.eat()
+		p.start()
+		key := p.parseNextExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			p.finish(HashPair)
+			return &ast.BadExpression{Token: hash.Token}
+		}
+
+		value := p.parseNextExpression(LOWEST)
+		p.finish(HashPair)
+		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
+
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+		// ','和'}'都可以跟在pair后面，错误信息里两个都要提到
+		if !p.peekTokenIs(token.COMMA) {
+			msg := fmt.Sprintf("expected ',' or '}' after a hash pair, got %s instead", p.peekToken.Type)
+			d := p.addError(p.peekToken, CodeUnexpectedToken, msg)
+			d.Expected = []token.TokenType{token.COMMA, token.RBRACE}
+			return &ast.BadExpression{Token: hash.Token}
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return &ast.BadExpression{Token: hash.Token}
+	}
+
+	return hash
+}
+
+func (p *Parser) noPrefixParseFnError(tok token.Token) {
+	msg := fmt.Sprintf("no prefix parse function for %s found", tok.Type)
+	p.addError(tok, CodeNoPrefixParseFn, msg)
 }
 
@@ -4,7 +4,9 @@ import (
 	"testing"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
     "fmt"
+	"strings"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -55,16 +57,16 @@ func testLetStatement(t *testing.T, s ast.Statement, identifier string) bool {
 		return false
 	}
 
-	if letstmt.Identifier.TokenLiteral() != identifier {
-		t.Errorf("letstmt.Identifier=%s, want %q",
-			letstmt.Identifier.TokenLiteral(),
+	if letstmt.Name.TokenLiteral() != identifier {
+		t.Errorf("letstmt.Name=%s, want %q",
+			letstmt.Name.TokenLiteral(),
 			identifier)
 		return false
 	}
 
-	if letstmt.Identifier.Value != identifier {
-		t.Errorf("letstmt.Identifier.Value=%s, want %q",
-			letstmt.Identifier.Value,
+	if letstmt.Name.Value != identifier {
+		t.Errorf("letstmt.Name.Value=%s, want %q",
+			letstmt.Name.Value,
 			identifier)
 		return false
 	}
@@ -100,7 +102,7 @@ func TestReturnStatements(t *testing.T) {
 		}
 
 		if !testReturnStatement(t, stmt) ||
-			!testLiteralExpression(t, stmt.Value, tt.value) {
+			!testLiteralExpression(t, stmt.ReturnValue, tt.value) {
 			t.FailNow()
 		}
 	}
@@ -121,6 +123,29 @@ func testReturnStatement(t *testing.T, s ast.Statement) bool {
 	return true
 }
 
+func TestStatementValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2 * 3", "let x = (1 + (2 * 3));"},
+		{"let y = -x; let z = y", "let y = (-x);let z = y;"},
+		{"return x + 1", "return (x + 1);"},
+		{"return; 5", "return ;5"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() got %q, want %q", program.String(), tt.expected)
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -152,6 +177,7 @@ func TestIntegerLiteralExpression(t *testing.T) {
 		{"005", 5},
 		{"010", 10},
 		{"0010", 10},
+		{"0_10", 10},
 	}
 
 	for _, tt := range tests {
@@ -174,6 +200,90 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+// Token.Literal keeps the integer as written, TokenLiteral() only drops the
+// leading zeros of a decimal one
+func TestIntegerLiteralSpelling(t *testing.T) {
+	tests := []struct {
+		input        string
+		value        int64
+		tokenLiteral string
+	}{
+		{"007", 7, "7"},
+		{"0_10", 10, "10"},
+		{"1_000", 1000, "1_000"},
+		{"0x1F", 31, "0x1F"},
+		{"0o17", 15, "0o17"},
+		{"0b_101", 5, "0b_101"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		integer, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("%q is not an *ast.IntegerLiteral", tt.input)
+		}
+		if integer.Value != tt.value {
+			t.Errorf("%q: integer.Value is %d, want %d", tt.input, integer.Value, tt.value)
+		}
+		if integer.TokenLiteral() != tt.tokenLiteral {
+			t.Errorf("%q: integer.TokenLiteral() is %s, want %s", tt.input, integer.TokenLiteral(), tt.tokenLiteral)
+		}
+		if integer.Token.Literal != tt.input {
+			t.Errorf("%q: integer.Token.Literal is %s", tt.input, integer.Token.Literal)
+		}
+	}
+}
+
+func TestNumberLiteralFormats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0x1F", int64(31)},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"1_000_000", int64(1000000)},
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"1_0.5e1", 105.0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		switch expected := tt.expected.(type) {
+		case int64:
+			integer, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if !ok {
+				castError(t, stmt.Expression, "*ast.IntegerLiteral")
+				continue
+			}
+			if integer.Value != expected {
+				t.Errorf("integer.Value is %d, want %d", integer.Value, expected)
+			}
+		case float64:
+			float, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok {
+				castError(t, stmt.Expression, "*ast.FloatLiteral")
+				continue
+			}
+			if float.Value != expected {
+				t.Errorf("float.Value is %g, want %g", float.Value, expected)
+			}
+		}
+		if stmt.Expression.TokenLiteral() != tt.input {
+			t.Errorf("TokenLiteral() is %q, want %q", stmt.Expression.TokenLiteral(), tt.input)
+		}
+	}
+}
+
 func TestBooleanLiteralExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -230,6 +340,7 @@ func TestPrefixExpressions(t *testing.T) {
 		{"-15", "-", 15},
 		{"!true", "!", true},
 		{"!false", "!", false},
+		{"~5", "~", 5},
 	}
 
 	for _, tt := range tests {
@@ -294,6 +405,13 @@ func TestInfixExpressions(t *testing.T) {
 		{`"foo" + "bar"`, "foo", "+", "bar"},
 		{`true && "foo"`, true, "&&", "foo"},
 		{`false || 10`, false, "||", 10},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"5 & 5", 5, "&", 5},
+		{"5 | 5", 5, "|", 5},
+		{"5 ^ 5", 5, "^", 5},
+		{"5 << 5", 5, "<<", 5},
+		{"5 >> 5", 5, ">>", 5},
 	}
 
 	for _, tt := range tests {
@@ -438,6 +556,34 @@ func TestOperatorPrecedence(t *testing.T) {
 			"i % 5 == 0 && !true",
 			"(((i % 5) == 0) && (!true))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b | c ^ d & e == f",
+			"(a && (b | (c ^ (d & (e == f)))))",
+		},
+		{
+			"a == b <= c << d + e % f",
+			"(a == (b <= (c << (d + (e % f)))))",
+		},
+		{
+			"a % b + c >> d >= e != f & g ^ h | i && j || k",
+			"((((((((((a % b) + c) >> d) >= e) != f) & g) ^ h) | i) && j) || k)",
+		},
+		{
+			"~a & ~b[1]",
+			"((~a) & (~(b[1])))",
+		},
+		{
+			"-a % b << !c",
+			"(((-a) % b) << (!c))",
+		},
+		{
+			"a < b >= c <= d",
+			"(((a < b) >= c) <= d)",
+		},
 		// Index.
 		{
 			"a * [1, 2, 3, 4][b * c] * d",
@@ -462,6 +608,124 @@ func TestOperatorPrecedence(t *testing.T) {
 	}
 }
 
+func TestBinaryOperatorPrecedenceCombinations(t *testing.T) {
+	// binary operators from the lowest to the highest precedence level
+	levels := [][]string{
+		{"||"},
+		{"&&"},
+		{"|"},
+		{"^"},
+		{"&"},
+		{"==", "!="},
+		{"<", ">", "<=", ">="},
+		{"<<", ">>"},
+		{"+", "-"},
+		{"*", "/", "%"},
+	}
+
+	for i, left := range levels {
+		for j, right := range levels {
+			for _, op1 := range left {
+				for _, op2 := range right {
+					input := fmt.Sprintf("a %s b %s c", op1, op2)
+
+					// 优先级相同时左结合
+					expected := fmt.Sprintf("((a %s b) %s c)", op1, op2)
+					if i < j {
+						expected = fmt.Sprintf("(a %s (b %s c))", op1, op2)
+					}
+
+					l := lexer.New(input)
+					p := New(l)
+					program := p.ParseProgram()
+					checkParserErrors(t, p)
+
+					if program.String() != expected {
+						t.Errorf("%q got %q, want %q", input, program.String(), expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 5 + 1", "(x = (y = (5 + 1)))"},
+		{"x += 1; x -= 1", "(x += 1)(x -= 1)"},
+		{"arr[i] = v", "((arr[i]) = v)"},
+		{`h["k"] *= 2 * 3`, "((h[k]) *= (2 * 3))"},
+		{"h.k.j /= a || b", "(((h.k).j) /= (a || b))"},
+		{"a %= b == c", "(a %= (b == c))"},
+		{"let f = fn(y) { y = y + 1 }", "let f = fn(y) (y = (y + 1));"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() got %q, want %q", program.String(), tt.expected)
+		}
+	}
+
+	l := lexer.New("arr[0] += 1")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	assign, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		castError(t, stmt.Expression, "*ast.AssignExpression")
+		t.FailNow()
+	}
+	if assign.Operator != "+=" {
+		t.Errorf("assign.Operator is %q, want %q", assign.Operator, "+=")
+	}
+	if _, ok := assign.Target.(*ast.IndexExpression); !ok {
+		castError(t, assign.Target, "*ast.IndexExpression")
+	}
+	testIntegerLiteralExpression(t, assign.Value, 1)
+}
+
+func TestInvalidAssignTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "1:3: error: cannot assign to 1"},
+		{"a + b = c", "1:7: error: cannot assign to (a + b)"},
+		{"f() += 1", "1:5: error: cannot assign to f()"},
+		{"(x = 1) = 2", "1:9: error: cannot assign to (x = 1)"},
+		{"h.1 = 2", "1:3: error: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: parser has %d errors, want 1: %s", tt.input, len(errors), errors.Text())
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: error is %q, want %q", tt.input, errors[0].Error(), tt.expected)
+		}
+		if tt.input != "h.1 = 2" && errors[0].Code != CodeInvalidAssign {
+			t.Errorf("%q: error code is %q, want %q", tt.input, errors[0].Code, CodeInvalidAssign)
+		}
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	tests := []struct {
 		input       string
@@ -511,6 +775,105 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 3) { x += 1; }", "while(x < 3) (x += 1)"},
+		{"for (let i = 0; i < 3; i += 1) { x }", "for (let i = 0; (i < 3); (i += 1)) x"},
+		{"for (i = 0; i < 3; i += 1) { x }", "for ((i = 0); (i < 3); (i += 1)) x"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (; i;) { continue }", "for (; i; ) continue;"},
+		{"for (x in [1, 2]) { x }", "for (x in [1, 2]) x"},
+		{"for (k in h) { if (k) { break } }", "for (k in h) ifk break;"},
+		{"while (true) { let f = fn() { 1 }; break; }", "whiletrue let f = fn() 1;break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program has %d statements, want 1", tt.input, len(program.Statements))
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestLoopStatementNodes(t *testing.T) {
+	program := New(lexer.New("for (x in xs) { x } for (let i = 0; i < 3; i += 1) {} while (x) {}")).ParseProgram()
+	if len(program.Statements) != 3 {
+		t.Fatalf("program has %d statements, want 3", len(program.Statements))
+	}
+
+	forIn, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("statement 0 is %T, want *ast.ForInStatement", program.Statements[0])
+	}
+	if !testIdentifierExpression(t, forIn.Variable, "x") || !testIdentifierExpression(t, forIn.Iterable, "xs") {
+		return
+	}
+
+	forStmt, ok := program.Statements[1].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("statement 1 is %T, want *ast.ForStatement", program.Statements[1])
+	}
+	if _, ok := forStmt.Init.(*ast.LetStatement); !ok {
+		t.Errorf("for init is %T, want *ast.LetStatement", forStmt.Init)
+	}
+	cond, ok := forStmt.Condition.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("for condition is %T, want *ast.InfixExpression", forStmt.Condition)
+	}
+	if !testIdentifierExpression(t, cond.Left, "i") || !testIntegerLiteralExpression(t, cond.Right, 3) {
+		return
+	}
+	if len(forStmt.Body.Statements) != 0 {
+		t.Errorf("for body has %d statements, want 0", len(forStmt.Body.Statements))
+	}
+
+	while, ok := program.Statements[2].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("statement 2 is %T, want *ast.WhileStatement", program.Statements[2])
+	}
+	testIdentifierExpression(t, while.Condition, "x")
+}
+
+func TestBranchOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: error: break is not in a loop"},
+		{"if (x) { continue }", "1:10: error: continue is not in a loop"},
+		{"while (x) { fn() { break } }", "1:20: error: break is not in a loop"},
+		{"for (x in xs) {} continue", "1:18: error: continue is not in a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: parser has %d errors, want 1: %s", tt.input, len(errors), errors.Text())
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: error is %q, want %q", tt.input, errors[0].Error(), tt.expected)
+		}
+		if errors[0].Code != CodeOutsideLoop {
+			t.Errorf("%q: error code is %q, want %q", tt.input, errors[0].Code, CodeOutsideLoop)
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	tests := []struct {
 		input      string
@@ -686,7 +1049,7 @@ func TestEmptyHashLiteralExpression(t *testing.T) {
 		t.FailNow()
 	}
 	if len(hash.Pairs) != 0 {
-		t.Error("len(hash.Pairs) got %d, want %d",
+		t.Errorf("len(hash.Pairs) got %d, want %d",
 			len(hash.Pairs), 0)
 	}
 }
@@ -733,7 +1096,7 @@ func TestHashLiteralWithExpressions(t *testing.T) {
 			continue
 		}
 		if len(hash.Pairs) != len(tt.expected) {
-			t.Error("len(hash.Pairs) got %d, want %d",
+			t.Errorf("len(hash.Pairs) got %d, want %d",
 				len(hash.Pairs), len(tt.expected))
 			continue
 		}
@@ -849,6 +1212,203 @@ func TestComment(t *testing.T) {
 	}
 }
 
+func TestCommentTrivia(t *testing.T) {
+	input := `
+	// Doc comment.
+	let first = 1; /* trailing */
+	let second = 2;
+	`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := [][]string{{"// Doc comment."}, {"/* trailing */"}}
+	for i, s := range program.Statements {
+		comments := s.(*ast.LetStatement).Token.Comments
+		if len(comments) != len(expected[i]) || comments[0].Literal != expected[i][0] {
+			t.Errorf("statement %d has comments %v, want %q", i, comments, expected[i])
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x 5;\nlet = 10;"
+
+	l := lexer.NewFile("main.mk", input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) < 2 {
+		t.Fatalf("parser has %d errors, want at least 2", len(errors))
+	}
+
+	d := errors[0]
+	if d.Severity != SeverityError || d.Code != CodeUnexpectedToken {
+		t.Errorf("errors[0] is %s %q, want error %q", d.Severity, d.Code, CodeUnexpectedToken)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN || d.Found != token.INT {
+		t.Errorf("errors[0] expected %v found %s, want [=] found INT", d.Expected, d.Found)
+	}
+	if d.Span.Start.Line != 1 || d.Span.Start.Column != 7 || d.Span.End.Column != 8 {
+		t.Errorf("errors[0].Span is %s-%s, want main.mk:1:7-main.mk:1:8", d.Span.Start, d.Span.End)
+	}
+	if d.Error() != "main.mk:1:7: error: expected next token to be =, got INT instead" {
+		t.Errorf("errors[0].Error() is %q", d.Error())
+	}
+	if errors[1].Span.Start.Line != 2 {
+		t.Errorf("errors[1] is at line %d, want 2", errors[1].Span.Start.Line)
+	}
+
+	// 字符串的span是源码里的宽度，包括引号和转义
+	p = New(lexer.New(`let "a\tb" = 1;`))
+	p.ParseProgram()
+	if d := p.Errors()[0]; d.Span.Start.Column != 5 || d.Span.End.Column != 11 {
+		t.Errorf("string token span is %s-%s, want 1:5-1:11", d.Span.Start, d.Span.End)
+	}
+
+	js, err := errors[:1].JSON()
+	if err != nil {
+		t.Fatalf("JSON() failed: %s", err)
+	}
+	want := `[{"severity":"error","span":{"start":{"filename":"main.mk","offset":6,"line":1,"column":7,"runeColumn":7},` +
+		`"end":{"filename":"main.mk","offset":7,"line":1,"column":8,"runeColumn":8}},"code":"unexpected-token",` +
+		`"expected":["="],"found":"INT","message":"expected next token to be =, got INT instead"}]`
+	if string(js) != want {
+		t.Errorf("JSON() is %s, want %s", js, want)
+	}
+}
+
+func TestErrorListSort(t *testing.T) {
+	at := func(offset int) *Diagnostic {
+		return &Diagnostic{Span: Span{Start: token.Position{Offset: offset, Line: 1, Column: offset + 1}}}
+	}
+	list := ErrorList{at(9), at(3), at(5)}
+	list.Sort()
+
+	for i, offset := range []int{3, 5, 9} {
+		if list[i].Span.Start.Offset != offset {
+			t.Errorf("list[%d] is at offset %d, want %d", i, list[i].Span.Start.Offset, offset)
+		}
+	}
+	if (ErrorList{}).Err() != nil {
+		t.Errorf("empty ErrorList.Err() is not nil")
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements []string
+	}{
+		{
+			"let x 5;\nlet = 10;\nlet y = 3;",
+			[]string{
+				"1:7: error: expected next token to be =, got INT instead",
+				"2:5: error: expected next token to be IDENT, got = instead",
+			},
+			[]string{"*ast.BadStatement", "*ast.BadStatement", "*ast.LetStatement"},
+		},
+		{
+			"* 5 + 3; 10",
+			[]string{"1:1: error: no prefix parse function for * found"},
+			[]string{"*ast.ExpressionStatement", "*ast.ExpressionStatement"},
+		},
+		{
+			"let 5 + * 3 let a = 1;",
+			[]string{"1:5: error: expected next token to be IDENT, got INT instead"},
+			[]string{"*ast.BadStatement", "*ast.LetStatement"},
+		},
+		{
+			"let f = fn(x) { x + }; let y = 1;",
+			[]string{"1:21: error: no prefix parse function for } found"},
+			[]string{"*ast.LetStatement", "*ast.LetStatement"},
+		},
+		{
+			"if (x { y }; 5",
+			[]string{"1:7: error: expected next token to be ), got { instead"},
+			[]string{"*ast.ExpressionStatement", "*ast.ExpressionStatement"},
+		},
+		{
+			"add(1, , 2); [1 2]; {1 2}",
+			[]string{
+				"1:8: error: no prefix parse function for , found",
+				"1:17: error: expected next token to be ], got INT instead",
+				"1:24: error: expected next token to be :, got INT instead",
+			},
+			[]string{"*ast.ExpressionStatement", "*ast.ExpressionStatement", "*ast.ExpressionStatement"},
+		},
+		{
+			"fn(x) { let = 1; x",
+			[]string{
+				"1:13: error: expected next token to be IDENT, got = instead",
+				"1:19: error: expected } to close the block at 1:7, got EOF instead",
+			},
+			[]string{"*ast.ExpressionStatement"},
+		},
+		{
+			"let s = \"a\\qb\"; let t = \"open\nlet u = @;",
+			[]string{
+				"1:11: error: unknown escape sequence \\q",
+				"1:30: error: string literal not terminated",
+				"2:9: error: illegal character '@'",
+			},
+			[]string{"*ast.LetStatement", "*ast.LetStatement", "*ast.LetStatement"},
+		},
+		{
+			"let a = 0x; let b = 1__0 + 9223372036854775808; let c = 1e999;",
+			[]string{
+				"1:9: error: hexadecimal literal has no digits",
+				"1:23: error: '_' must separate successive digits",
+				"1:57: error: could not parse \"1e999\" as float",
+			},
+			[]string{"*ast.LetStatement", "*ast.LetStatement", "*ast.LetStatement"},
+		},
+		{
+			"let h = {1: 2 3: 4}; let i = 1;",
+			[]string{"1:15: error: expected ',' or '}' after a hash pair, got INT instead"},
+			[]string{"*ast.LetStatement", "*ast.LetStatement"},
+		},
+		{
+			"{1:2",
+			[]string{"1:5: error: expected ',' or '}' after a hash pair, got EOF instead"},
+			[]string{"*ast.ExpressionStatement"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("parser has %d errors, want %d: %s", len(errors), len(tt.errors), errors.Text())
+			continue
+		}
+		for i, d := range errors {
+			if d.Error() != tt.errors[i] {
+				t.Errorf("errors[%d] is %q, want %q", i, d.Error(), tt.errors[i])
+			}
+		}
+
+		if len(program.Statements) != len(tt.statements) {
+			t.Errorf("len(program.Statements) got %d, want %d",
+				len(program.Statements), len(tt.statements))
+			continue
+		}
+		for i, s := range program.Statements {
+			if fmt.Sprintf("%T", s) != tt.statements[i] {
+				castError(t, s, tt.statements[i])
+			}
+		}
+	}
+}
+
 // Helper functions for testing.
 
 func testIdentifierExpression(t *testing.T, expr ast.Expression, value string) bool {
@@ -897,7 +1457,7 @@ func testBooleanLiteralExpression(t *testing.T, expr ast.Expression, value bool)
 		return false
 	}
 	if boolean.TokenLiteral() != fmt.Sprintf("%t", value) {
-		t.Errorf("boolean.TokenLiteral() is %t, want %t",
+		t.Errorf("boolean.TokenLiteral() is %s, want %t",
 			boolean.TokenLiteral(), value)
 		return false
 	}
@@ -955,4 +1515,87 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 func castError(t *testing.T, got interface{}, want string) {
 	t.Errorf("cast error: got %T, want %s", got, want)
-}
\ No newline at end of file
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+	// comment
+	let add = fn(a, b) { return a + b; };
+	let h = {"one": 1, 2: [1.5, true], "f": fn() {}};
+	for (let i = 0; i < 3; i += 1) { if (i == 1) { continue } else { h.k = -i } }
+	while (!false) { break; }
+	for (x in h) { add(x, h[x]) }
+	`
+
+	l := lexer.NewFile("test.mk", input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+
+	if node.String() != program.String() {
+		t.Errorf("got %q, want %q", node.String(), program.String())
+	}
+	again, err := ast.MarshalJSON(node)
+	if err != nil {
+		t.Fatalf("MarshalJSON after decoding: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON changed after a round trip:\n%s\n%s", data, again)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3;", "(Program (ExpressionStatement (InfixExpression (IntegerLiteral 1) + (InfixExpression (IntegerLiteral 2) * (IntegerLiteral 3))) ;) EOF)"},
+		{"f(a)", "(Program (ExpressionStatement (CallExpression (Identifier f) (ArgumentList ( (Identifier a) )))) EOF)"},
+		{"let x = ;", "(Program (LetStatement let (Identifier x) = (BadExpression) ;) EOF)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.SetMode(RecordEvents)
+		p.ParseProgram()
+
+		// 每个node的kind在EventFinish里，先收集children
+		var stack [][]string
+		var got string
+		for _, e := range p.Events() {
+			top := len(stack) - 1
+			switch e.Type {
+			case EventStart:
+				stack = append(stack, nil)
+			case EventToken:
+				text := e.Token.Literal
+				if e.Token.Type == token.EOF {
+					text = "EOF"
+				}
+				stack[top] = append(stack[top], text)
+			case EventFinish:
+				node := "(" + strings.Join(append([]string{string(e.Kind)}, stack[top]...), " ") + ")"
+				stack = stack[:top]
+				if top == 0 {
+					got = node
+				} else {
+					stack[top-1] = append(stack[top-1], node)
+				}
+			}
+		}
+
+		if got != tt.expected {
+			t.Errorf("events of %q give %s, want %s", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package repl
+
+import (
+	"fmt"
+	"monkey/object"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===================== 命令 ================
+// a command is a line starting with ':', arg is the rest of the line
+type command struct {
+	run   func(s *session, arg string)
+	arg   string // what the argument is, empty if the command takes none
+	usage string
+}
+
+var commands map[string]command
+
+// :help lists the commands, it is registered in init to break the
+// initialization cycle
+func init() {
+	commands = map[string]command{
+		"tokens": {run: mode("tokens"), usage: "print the tokens of the inputs"},
+		"ast":    {run: mode("ast"), usage: "print the inputs as an indented tree"},
+		"sexpr":  {run: mode("sexpr"), usage: "print the inputs as S-expressions"},
+		"eval":   {run: mode("eval"), usage: "evaluate the inputs (default)"},
+		"load":   {run: (*session).load, arg: "file.mk", usage: "run a script in the session"},
+		"save":   {run: (*session).save, arg: "file.mk", usage: "write the inputs run so far to a file"},
+		"env":    {run: (*session).printEnv, usage: "list the bindings and their values"},
+		"reset":  {run: (*session).reset, usage: "clear the bindings and the inputs run so far"},
+		"time":   {run: (*session).measure, arg: "expr", usage: "evaluate expr, report the time and the allocations"},
+		"help":   {run: (*session).help, usage: "show this help"},
+	}
+}
+
+func mode(name string) func(s *session, arg string) {
+	return func(s *session, arg string) { s.mode = name }
+}
+
+// command runs a line like ":load file.mk"
+func (s *session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, ":")), " ")
+	arg = strings.TrimSpace(arg)
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %s, :help lists the commands\n", strings.TrimSpace(line))
+		return
+	}
+	if (cmd.arg == "") != (arg == "") {
+		fmt.Fprintf(s.out, "usage: %s\n", strings.TrimSpace(":"+name+" "+cmd.arg))
+		return
+	}
+
+	cmd.run(s, arg)
+}
+
+func (s *session) help(arg string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(s.out, "  %-16s %s\n", strings.TrimSpace(":"+name+" "+cmd.arg), cmd.usage)
+	}
+	fmt.Fprintln(s.out, "an input goes on while a bracket is open, a blank line submits it")
+}
+
+// load runs a script like an input, the parser errors refer to the file
+func (s *session) load(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	program := s.parse(filename, string(data))
+	if program == nil {
+		return
+	}
+	s.show(strings.TrimSuffix(string(data), "\n"), s.run(program))
+}
+
+// save writes the inputs run without error since the start or the last
+// :reset, so that :load replays the session
+func (s *session) save(filename string) {
+	var out strings.Builder
+	for _, input := range s.inputs {
+		out.WriteString(input)
+		out.WriteString("\n")
+	}
+
+	if err := os.WriteFile(filename, []byte(out.String()), 0644); err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved %d inputs to %s\n", len(s.inputs), filename)
+}
+
+func (s *session) printEnv(arg string) {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, inspect(value))
+	}
+}
+
+// inspect is value.Inspect(), a nil is null. a value that can't be printed
+// doesn't stop the listing
+func inspect(value object.Object) (text string) {
+	if value == nil {
+		return "null"
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			text = fmt.Sprintf("<%s: %v>", value.Type(), r)
+		}
+	}()
+	return value.Inspect()
+}
+
+func (s *session) reset(arg string) {
+	s.env = object.NewEnvironment()
+	s.inputs = nil
+}
+
+// measure evaluates the input like :eval does, whatever the mode. The
+// allocations are counted for the whole process, other goroutines included
+func (s *session) measure(input string) {
+	program := s.parse("", input)
+	if program == nil {
+		return
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	evaluated := s.run(program)
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	s.show(input, evaluated)
+	fmt.Fprintf(s.out, "time: %s, allocations: %d (%d bytes)\n",
+		elapsed, after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc)
+}
@@ -0,0 +1,528 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ===================== 读取输入 ================
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineReader prints the prompt and reads one line without its '\n'
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	AddHistory(line string)
+}
+
+// newLineReader uses the line editor when in and out are a terminal, and
+// plain lines otherwise, e.g. for a pipe or a dumb terminal
+func newLineReader(in io.Reader, out io.Writer, complete func(prefix string) []string) lineReader {
+	f, ok := in.(*os.File)
+	o, isFile := out.(*os.File)
+	if ok && isFile && isTerminal(int(f.Fd())) && isTerminal(int(o.Fd())) && os.Getenv("TERM") != "dumb" {
+		e := newEditor(f, out, int(f.Fd()), complete)
+		if home, err := os.UserHomeDir(); err == nil {
+			e.historyFile = filepath.Join(home, HISTORY_FILE)
+			e.loadHistory()
+		}
+		return e
+	}
+
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *plainReader) AddHistory(line string) {}
+
+// ===================== 行编辑器 ================
+// HISTORY_FILE is the history of the line editor, in the home directory
+const HISTORY_FILE = ".monkey_history"
+
+// maxHistory is the number of lines kept in the history
+const maxHistory = 1000
+
+// editor is a line editor for a terminal in raw mode, in the spirit of
+// readline with emacs keys:
+//
+//	Left, Right, Ctrl-B, Ctrl-F   move by one char, Alt-B and Alt-F by one word
+//	Home, End, Ctrl-A, Ctrl-E     move to the start or the end of the line
+//	Backspace, Delete, Ctrl-D     delete the char before or under the cursor
+//	Ctrl-W, Ctrl-U, Ctrl-K        delete the word before, or up to the start or the end
+//	Up, Down, Ctrl-P, Ctrl-N      walk through the history
+//	Ctrl-R                        search the history backwards
+//	Tab                           complete the word before the cursor
+//	Ctrl-L                        clear the screen
+//	Ctrl-C                        drop the line, Ctrl-D on an empty line ends the input
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int // terminal put in raw mode while reading, -1 for none
+	width    int // columns of the terminal, read again at each refresh, 0 if unknown
+	complete func(prefix string) []string
+
+	history     []string
+	historyFile string // the history is only kept in memory if empty
+
+	// the line being edited
+	prompt string
+	line   []rune
+	pos    int    // cursor, index in line
+	index  int    // entry of the history shown, len(history) for the new line
+	saved  string // the new line, while an older entry is shown
+}
+
+func newEditor(in io.Reader, out io.Writer, fd int, complete func(prefix string) []string) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, fd: fd, complete: complete}
+}
+
+func ctrl(key rune) rune { return key & 0x1f }
+
+const (
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		state, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore(e.fd, state)
+	}
+
+	e.prompt, e.line, e.pos = prompt, nil, 0
+	e.index, e.saved = len(e.history), ""
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.line) > 0 {
+				return e.submit(), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			return e.submit(), nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case ctrl('A'):
+			e.pos = 0
+		case ctrl('E'):
+			e.pos = len(e.line)
+		case ctrl('B'):
+			e.moveLeft()
+		case ctrl('F'):
+			e.moveRight()
+		case keyBackspace, ctrl('H'):
+			if e.pos > 0 {
+				e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+				e.pos--
+			}
+		case ctrl('K'):
+			e.line = e.line[:e.pos]
+		case ctrl('U'):
+			e.line = append([]rune{}, e.line[e.pos:]...)
+			e.pos = 0
+		case ctrl('W'):
+			start := e.wordLeft()
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+		case ctrl('L'):
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			e.historyMove(-1)
+		case ctrl('N'):
+			e.historyMove(1)
+		case ctrl('R'):
+			submit, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			if submit {
+				return e.submit(), nil
+			}
+		case '\t':
+			e.completeWord()
+		case keyEscape:
+			if err := e.escape(); err != nil {
+				return "", err
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert([]rune{r})
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+// submit shows the whole line and moves to the next one
+func (e *editor) submit() string {
+	e.pos = len(e.line)
+	e.refresh()
+	io.WriteString(e.out, "\r\n")
+	return string(e.line)
+}
+
+// refresh redraws the prompt and the line, then puts the cursor back. The
+// cursor moves by columns, not runes: a CJK char takes two, a combining mark
+// none. A line wider than the terminal would wrap and the cursor would end up
+// on the wrong row, so the line scrolls sideways: only the part around the
+// cursor is shown
+func (e *editor) refresh() {
+	if e.fd >= 0 {
+		e.width = terminalWidth(e.fd)
+	}
+
+	start, end := 0, len(e.line)
+	if e.width > 0 {
+		// 最后一列留空，光标在行尾时终端不会换行
+		room := e.width - runesWidth([]rune(e.prompt)) - 1
+		for start < e.pos && runesWidth(e.line[start:e.pos]) > room {
+			start++
+		}
+		for end > e.pos && runesWidth(e.line[start:end]) > room {
+			end--
+		}
+	}
+
+	var out strings.Builder
+
+	out.WriteString("\r")
+	out.WriteString(e.prompt)
+	out.WriteString(string(e.line[start:end]))
+	out.WriteString("\x1b[K")
+	if back := runesWidth(e.line[e.pos:end]); back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+
+	io.WriteString(e.out, out.String())
+}
+
+func (e *editor) bell() { io.WriteString(e.out, "\a") }
+
+func (e *editor) insert(runes []rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *editor) deleteForward() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+func (e *editor) moveLeft() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *editor) moveRight() {
+	if e.pos < len(e.line) {
+		e.pos++
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wordLeft is the start of the word before the cursor, spaces and symbols
+// before the cursor are skipped first
+func (e *editor) wordLeft() int {
+	i := e.pos
+	for i > 0 && !isWordRune(e.line[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(e.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+func (e *editor) wordRight() int {
+	i := e.pos
+	for i < len(e.line) && !isWordRune(e.line[i]) {
+		i++
+	}
+	for i < len(e.line) && isWordRune(e.line[i]) {
+		i++
+	}
+	return i
+}
+
+// escape reads the rest of an escape sequence: the arrow keys, Home, End and
+// Delete in their xterm and vt100 forms, and Alt-B, Alt-F
+func (e *editor) escape() error {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return err
+	}
+
+	switch r {
+	case 'b':
+		e.pos = e.wordLeft()
+		return nil
+	case 'f':
+		e.pos = e.wordRight()
+		return nil
+	case '[', 'O':
+	default:
+		return nil
+	}
+
+	// 参数是数字和分号，最后一个字符决定是哪个键
+	var params strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params.WriteRune(r)
+	}
+
+	switch string(r) + params.String() {
+	case "A":
+		e.historyMove(-1)
+	case "B":
+		e.historyMove(1)
+	case "C":
+		e.moveRight()
+	case "D":
+		e.moveLeft()
+	case "H", "~1", "~7":
+		e.pos = 0
+	case "F", "~4", "~8":
+		e.pos = len(e.line)
+	case "~3":
+		e.deleteForward()
+	}
+	return nil
+}
+
+// ===================== 历史 ================
+// historyMove shows an older (delta -1) or newer (delta 1) entry, the line
+// typed so far is kept until the user comes back to it
+func (e *editor) historyMove(delta int) {
+	i := e.index + delta
+	if i < 0 || i > len(e.history) {
+		e.bell()
+		return
+	}
+
+	if e.index == len(e.history) {
+		e.saved = string(e.line)
+	}
+	e.index = i
+
+	if i == len(e.history) {
+		e.line = []rune(e.saved)
+	} else {
+		e.line = []rune(e.history[i])
+	}
+	e.pos = len(e.line)
+}
+
+// AddHistory appends line to the history and to the history file, blank
+// lines and repeats of the last entry are skipped
+func (e *editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the history file, a file grown over maxHistory lines is
+// cut down to the last ones. a missing file is an empty history
+func (e *editor) loadHistory() {
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return
+	}
+
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		os.WriteFile(e.historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	e.history = lines
+}
+
+// search is the reverse incremental search of Ctrl-R: every key typed
+// narrows the search, Ctrl-R again finds an older match. Enter runs the match,
+// Ctrl-G or Ctrl-C go back to the line, any other key keeps the match for editing
+func (e *editor) search() (submit bool, err error) {
+	var query []rune
+	match := -1
+
+	// find looks for query in the entries from i backwards
+	find := func(i int) {
+		for ; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match = i
+				return
+			}
+		}
+		e.bell()
+	}
+
+	for {
+		status := "reverse-i-search"
+		found := ""
+		if match >= 0 {
+			found = e.history[match]
+		} else if len(query) > 0 {
+			status = "failed reverse-i-search"
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", status, string(query), found)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case r == ctrl('R'):
+			if match > 0 {
+				find(match - 1)
+			} else if match < 0 && len(query) > 0 {
+				find(len(e.history) - 1)
+			}
+		case r == keyBackspace || r == ctrl('H'):
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = -1
+				find(len(e.history) - 1)
+			}
+		case r == ctrl('G') || r == ctrl('C'):
+			return false, nil
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			// 当前的结果可能还匹配更长的query
+			from := match
+			if from < 0 {
+				from = len(e.history) - 1
+			}
+			match = -1
+			find(from)
+		default:
+			if match >= 0 {
+				if e.index == len(e.history) {
+					e.saved = string(e.line)
+				}
+				e.line = []rune(e.history[match])
+				e.pos = len(e.line)
+				e.index = match
+			}
+			if r == '\r' || r == '\n' {
+				return true, nil
+			}
+			// 其他的键交给ReadLine处理
+			e.in.UnreadRune()
+			return false, nil
+		}
+	}
+}
+
+// ===================== 补全 ================
+// completeWord completes the word before the cursor with the candidates of
+// e.complete: a single one is inserted, several are completed up to their
+// common prefix and listed when that adds nothing. A ':' at the start of the
+// line is part of the word, so that commands complete too
+func (e *editor) completeWord() {
+	start := e.pos
+	for start > 0 && isWordRune(e.line[start-1]) {
+		start--
+	}
+	if start == 1 && e.line[0] == ':' {
+		start = 0
+	}
+
+	prefix := string(e.line[start:e.pos])
+	if prefix == "" || e.complete == nil {
+		e.bell()
+		return
+	}
+
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		e.bell()
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+
+	if len(common) > len(prefix) {
+		e.insert([]rune(common[len(prefix):]))
+		return
+	}
+	if len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
@@ -3,30 +3,270 @@ package repl
 // monkey language should be repl one!
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 const PROMPT = ">> "
+const CONTINUATION_PROMPT = ".. "
 
+// a mode decides what the REPL does with an input, :tokens, :ast, :sexpr and
+// :eval switch between them
+var modes = map[string]func(s *session, input string){
+	"tokens": (*session).printTokens,
+	"ast":    (*session).printAST,
+	"sexpr":  (*session).printSExpr,
+	"eval":   (*session).eval,
+}
+
+// session is the state kept between two inputs
+type session struct {
+	out    io.Writer
+	env    *object.Environment
+	mode   string
+	inputs []string // inputs evaluated without error, for :save
+}
+
+// Start reads inputs from in and prints the results to out. On a terminal the
+// lines are read with a line editor (see editor), with history and completion.
+// A line starting with ':' is a command, :help lists them. An input may span
+// several lines: while it is not complete (see continuation) the REPL shows
+// CONTINUATION_PROMPT, a blank line submits it anyway. In the default eval
+// mode the bindings of an input are kept for the following ones
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	s := &session{out: out, env: object.NewEnvironment(), mode: "eval"}
+	r := newLineReader(in, out, s.complete)
 
+	input, sep := "", ""
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		prompt := PROMPT
+		if input != "" {
+			prompt = CONTINUATION_PROMPT
+		}
+
+		line, err := r.ReadLine(prompt)
+		if err == errInterrupted {
+			// Ctrl-C丢掉没写完的输入
+			input = ""
+			continue
+		}
+		if err != nil {
+			// 输入结束时提交没写完的部分
+			if input != "" {
+				modes[s.mode](s, input)
+			}
 			return
-		}			
+		}
+		r.AddHistory(line)
+
+		switch {
+		case input == "" && strings.HasPrefix(line, ":"):
+			s.command(line)
+			continue
+		case input == "" && strings.TrimSpace(line) == "":
+			// 没有待提交的输入时空行什么都不做，也不会被:save保存
+			continue
+		case input == "":
+			input = line
+		case strings.TrimSpace(line) == "":
+			// 空行直接提交
+		default:
+			input += sep + line
+		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		var more bool
+		if more, sep = continuation(input); more && strings.TrimSpace(line) != "" {
+			continue
+		}
+
+		modes[s.mode](s, input)
+		input = ""
+	}
+}
+
+// continuation tells if input needs more lines: a '(', '{' or '[' is not
+// closed, a string or a block comment is not terminated, or the last token is
+// an operator or a ','. sep joins the next line to input: a string can't
+// span lines, so a line break inside one is written as the escape \n
+func continuation(input string) (more bool, sep string) {
+	l := lexer.New(input)
+
+	depth := 0
+	last := token.Token{Type: token.EOF}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+		last = tok
+	}
+
+	if last.Type == token.ILLEGAL {
+		// 字符串没结束时，错误在输入的末尾
+		if strings.HasPrefix(last.Literal, `"`) {
+			for _, e := range l.Errors() {
+				if e.Pos.Offset == len(input) {
+					return true, `\n`
+				}
+			}
+		}
+		if strings.HasPrefix(last.Literal, "/*") {
+			return true, "\n"
+		}
+	}
+
+	switch last.Type {
+	case token.BANG, token.BIT_NOT, token.COMMA, token.COLON:
+		return true, "\n"
+	}
+	if parser.Precedence(last.Type) > parser.LOWEST {
+		return true, "\n"
+	}
+
+	return depth > 0, "\n"
+}
+
+// complete returns the keywords, the names bound in the session and the
+// commands that start with prefix, for Tab in the line editor
+func (s *session) complete(prefix string) []string {
+	var candidates []string
+
+	if strings.HasPrefix(prefix, ":") {
+		for name := range commands {
+			if strings.HasPrefix(":"+name, prefix) {
+				candidates = append(candidates, ":"+name)
+			}
+		}
+		sort.Strings(candidates)
+		return candidates
+	}
+
+	for _, name := range append(token.Keywords(), s.env.Names()...) {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// ===================== modes ================
+// printTokens prints every token of the input, the lexer is not followed by the parser
+func (s *session) printTokens(input string) {
+	l := lexer.New(input)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%+v\n", tok)
+	}
+}
+
+func (s *session) printAST(input string) {
+	if program := s.parse("", input); program != nil {
+		io.WriteString(s.out, ast.ToTree(program))
+	}
+}
+
+func (s *session) printSExpr(input string) {
+	if program := s.parse("", input); program != nil {
+		io.WriteString(s.out, ast.ToSExpr(program))
+	}
+}
+
+func (s *session) eval(input string) {
+	if program := s.parse("", input); program != nil {
+		s.show(input, s.run(program))
+	}
+}
+
+// run evaluates program in the session, a panic of the evaluator becomes an
+// error so that the session goes on
+func (s *session) run(program *ast.Program) (evaluated object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			evaluated = &object.Error{Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	return evaluator.Eval(program, s.env)
+}
+
+// show prints the value of input, an input that ran without error is kept for :save
+func (s *session) show(input string, evaluated object.Object) {
+	if _, failed := evaluated.(*object.Error); !failed {
+		s.inputs = append(s.inputs, input)
+	}
+
+	// let这种语句没有值
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// parse returns nil after printing the errors if input is not a valid
+// program, the diagnostics show the filename if there is one
+func (s *session) parse(filename string, input string) *ast.Program {
+	p := parser.New(lexer.NewFile(filename, input))
+
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		printParserErrors(s.out, input, errors)
+		return nil
+	}
+
+	return program
+}
+
+// printParserErrors shows the source line of each diagnostic with a caret
+// under the tokens it refers to:
+//
+//	let x = ;
+//	        ^ no prefix parse function for ; found
+func printParserErrors(out io.Writer, input string, errors parser.ErrorList) {
+	lines := strings.Split(input, "\n")
+
+	for _, d := range errors {
+		start, end := d.Span.Start, d.Span.End
+		if start.Line < 1 || start.Line > len(lines) {
+			fmt.Fprintf(out, "%s\n", d.Message)
+			continue
+		}
+		line := lines[start.Line-1]
+
+		// tab要原样保留，否则^对不齐
+		var indent strings.Builder
+		for i, r := range line {
+			if i >= start.Column-1 {
+				break
+			}
+			if r == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+
+		width := 1
+		if end.Line == start.Line && end.Offset > start.Offset && end.Column-1 <= len(line) {
+			width = utf8.RuneCountInString(line[start.Column-1 : end.Column-1])
+		}
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		// 文件里的错误带上位置
+		msg := d.Message
+		if start.Filename != "" {
+			msg = d.Error()
 		}
+		fmt.Fprintf(out, "%s\n%s%s %s\n", line, indent.String(), strings.Repeat("^", width), msg)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,564 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run feeds input to Start and returns what it printed, prompts left out
+func run(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	printed := strings.ReplaceAll(out.String(), PROMPT, "")
+	return strings.ReplaceAll(printed, CONTINUATION_PROMPT, "")
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + 5\n", "10\n"},
+		{"\"hello\"\n", "hello\n"},
+		{"let x = 5;\n", ""},
+		// 环境在输入之间保留
+		{"let x = 5;\nx * 2\n", "10\n"},
+		{"let add = fn(a, b) { a + b };\nadd(1, 2)\nadd(add(1, 2), 3)\n", "3\n6\n"},
+		{"let a = [1, 2];\na[0] = 3;\na\n", "3\n[3, 2]\n"},
+		{"y\n", "ERROR: identifier not found: y\n"},
+		// 出错之后会话继续
+		{"fn() {}() + 1\n1\n", "ERROR: type mismatch: NULL + INTEGER\n1\n"},
+		{"let a = fn() {}();\na\n", "null\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := run(tt.input); got != tt.expected {
+			t.Errorf("input %q printed %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	s := &session{out: io.Discard, env: object.NewEnvironment(), mode: "eval"}
+
+	// 解析器不会生成没有consequence的if，求值时panic
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.IfExpression{Condition: &ast.BooleanLiteral{Value: true}}},
+	}}
+
+	errObj, ok := s.run(program).(*object.Error)
+	if !ok || !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Fatalf("run returned %v, want an internal error", errObj)
+	}
+}
+
+func TestStartPrompt(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("1\n2\n"), &out)
+
+	expected := ">> 1\n>> 2\n>> "
+	if out.String() != expected {
+		t.Errorf("printed %q, want %q", out.String(), expected)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = ;\n",
+			"let x = ;\n        ^ no prefix parse function for ; found\n",
+		},
+		{
+			"let 5 = 1;\n",
+			"let 5 = 1;\n    ^ expected next token to be IDENT, got INT instead\n",
+		},
+		{
+			"\tlet = 1;\n",
+			"\tlet = 1;\n\t    ^ expected next token to be IDENT, got = instead\n",
+		},
+		{
+			"let s = \"é\" + ;\n",
+			"let s = \"é\" + ;\n              ^ no prefix parse function for ; found\n",
+		},
+		{
+			"1 + 1 = 2\n",
+			"1 + 1 = 2\n      ^ cannot assign to (1 + 1)\n",
+		},
+		// ^的宽度是源码里的字符串，不是解码后的值
+		{
+			"let \"a\\tb\" = 1;\n",
+			"let \"a\\tb\" = 1;\n    ^^^^^^ expected next token to be IDENT, got STRING instead\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := run(tt.input); got != tt.expected {
+			t.Errorf("input %q printed\n%s\nwant\n%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens\nlet x\n", "{Type:LET Literal:let Pos:1:1 End:1:4 Comments:[]}\n{Type:IDENT Literal:x Pos:1:5 End:1:6 Comments:[]}\n"},
+		{":ast\n-a * b\n", "Program\n  ExpressionStatement\n    InfixExpression *\n      PrefixExpression -\n        Identifier a\n      Identifier b\n"},
+		{":sexpr\n1 + 2 * 3\na = b = c\n", "(+ 1 (* 2 3))\n(= a (= b c))\n"},
+		// 切换模式不影响环境
+		{"let x = 2;\n:sexpr\nx * 3\n:eval\nx * 3\n", "(* x 3)\n6\n"},
+		{":ast\nlet = 1\n", "let = 1\n    ^ expected next token to be IDENT, got = instead\n"},
+		{":tokens\n\"a\n", "{Type:ILLEGAL Literal:\"a Pos:1:1 End:1:3 Comments:[]}\n"},
+		{": sexpr \n!x\n", "(! x)\n"},
+		{":nope\n1\n", "unknown command :nope, :help lists the commands\n1\n"},
+	}
+
+	for _, tt := range tests {
+		if got := run(tt.input); got != tt.expected {
+			t.Errorf("input %q printed\n%s\nwant\n%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestMultiLine(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(x, y) {\nx + y\n};\nadd(1, 2)\n", "3\n"},
+		{"[1,\n2,\n3]\n", "[1, 2, 3]\n"},
+		{"{\"a\":\n1}\n", "{a: 1}\n"},
+		{"1 +\n2 *\n3\n", "7\n"},
+		{"let x =\n5; x\n", "5\n"},
+		{"!\ntrue\n", "false\n"},
+		// 字符串里的换行变成转义
+		{"\"a\nb\"\n", "a\nb\n"},
+		{"1 /* a\nb */ + 1\n", "2\n"},
+		// 空行提交没写完的输入
+		{"fn(x) {\n\n5\n", "fn(x) {\n       ^ expected } to close the block at 1:7, got EOF instead\n5\n"},
+		// 输入结束时也提交
+		{"1 +\n2", "3\n"},
+		{"1 + 2)\n", "1 + 2)\n     ^ no prefix parse function for ) found\n"},
+		// 命令只在输入的开头才有效
+		{"if (true) {\n:ast\n}\n", ":ast\n^ no prefix parse function for : found\n"},
+	}
+
+	for _, tt := range tests {
+		if got := run(tt.input); got != tt.expected {
+			t.Errorf("input %q printed\n%s\nwant\n%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestContinuationPrompt(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let f = fn() {\n1\n}\nf()\n"), &out)
+
+	expected := ">> .. .. >> 1\n>> "
+	if out.String() != expected {
+		t.Errorf("printed %q, want %q", out.String(), expected)
+	}
+}
+
+func TestContinuation(t *testing.T) {
+	tests := []struct {
+		input string
+		more  bool
+	}{
+		{"", false},
+		{"let x = 1;", false},
+		{"fn(x) {", true},
+		{"fn(x) { x }", false},
+		{"foo(", true},
+		{"[1, [2]", true},
+		{"1 + 2)", false},
+		{"a.", true},
+		{"x +=", true},
+		{"1 && // why not", true},
+		{"let s = \"abc", true},
+		{"let s = \"abc\" + \"\\q\"", false},
+		{"/* comment", true},
+		{"/* comment */", false},
+		{"-", true},
+		{"return", false},
+	}
+
+	for _, tt := range tests {
+		if more, _ := continuation(tt.input); more != tt.more {
+			t.Errorf("continuation(%q) is %t, want %t", tt.input, more, tt.more)
+		}
+	}
+}
+
+// edit types keys into an editor that is not on a terminal and returns the
+// line it read
+func edit(t *testing.T, e *editor, keys string) string {
+	t.Helper()
+
+	e.in.Reset(strings.NewReader(keys))
+	line, err := e.ReadLine(PROMPT)
+	if err != nil {
+		t.Fatalf("keys %q: %v", keys, err)
+	}
+	return line
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc", "abc"},
+		{"ac\x02b\r", "abc"},
+		{"ac\x1b[Db\r", "abc"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"bc\x1b[Ha\x1b[Fd\r", "abcd"},
+		{"bc\x1b[1~a\x1b[4~d\r", "abcd"},
+		{"abc\x7f\x7fx\r", "ax"},
+		{"abc\x01\x04\r", "bc"},
+		{"abc\x01\x1b[3~\r", "bc"},
+		{"abc\x02\x02\x0b\r", "a"},
+		{"abc\x02\x15\r", "c"},
+		{"let foo = bar\x17baz\r", "let foo = baz"},
+		{"let foo = bar\x1bb\x1bbx\r", "let xfoo = bar"},
+		{"let foo\x01\x1bf!\r", "let! foo"},
+		{"é\x02ü\r", "üé"},
+		{"a\tb\r", "ab"},
+	}
+
+	for _, tt := range tests {
+		e := newEditor(nil, &bytes.Buffer{}, -1, nil)
+		if got := edit(t, e, tt.keys); got != tt.expected {
+			t.Errorf("keys %q read %q, want %q", tt.keys, got, tt.expected)
+		}
+	}
+}
+
+func TestEditorEndOfInput(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(nil, &out, -1, nil)
+
+	e.in.Reset(strings.NewReader("abc\x03"))
+	if _, err := e.ReadLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C returned %v, want errInterrupted", err)
+	}
+	if !strings.HasSuffix(out.String(), "^C\r\n") {
+		t.Errorf("Ctrl-C printed %q", out.String())
+	}
+
+	e.in.Reset(strings.NewReader("\x04"))
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D returned %v, want io.EOF", err)
+	}
+
+	e.in.Reset(strings.NewReader(""))
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("end of input returned %v, want io.EOF", err)
+	}
+}
+
+func TestEditorRefresh(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(nil, &out, -1, nil)
+	edit(t, e, "ab\x02\r")
+
+	expected := "\r>> \x1b[K" + "\r>> a\x1b[K" + "\r>> ab\x1b[K" + "\r>> ab\x1b[K\x1b[1D" +
+		"\r>> ab\x1b[K\r\n"
+	if out.String() != expected {
+		t.Errorf("printed %q, want %q", out.String(), expected)
+	}
+}
+
+// the cursor moves back by columns: 名 and 字 take two each, the accent none
+func TestEditorRefreshWidth(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let 名字 = 1\x02\x02\x02\x02\x02\r", "\r>> let 名字 = 1\x1b[K\x1b[6D"},
+		{"e\u0301x\x02\r", "\r>> e\u0301x\x1b[K\x1b[1D"},
+		{"ｘy\x01\r", "\r>> ｘy\x1b[K\x1b[3D"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := newEditor(nil, &out, -1, nil)
+		edit(t, e, tt.keys)
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("keys %q printed %q, want %q in it", tt.keys, out.String(), tt.expected)
+		}
+	}
+}
+
+// a line wider than the terminal scrolls, it never reaches the last column
+func TestEditorRefreshScroll(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(nil, &out, -1, nil)
+	e.width = 10
+
+	if line := edit(t, e, "abcdefghij\x01\r"); line != "abcdefghij" {
+		t.Fatalf("read %q", line)
+	}
+	for _, shown := range []string{"\r>> efghij\x1b[K\r", "\r>> abcdef\x1b[K\x1b[6D"} {
+		if !strings.Contains(out.String(), shown) {
+			t.Errorf("printed %q, want %q in it", out.String(), shown)
+		}
+	}
+	if strings.Contains(out.String(), "abcdefg") {
+		t.Errorf("printed %q, wider than the terminal", out.String())
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e := newEditor(nil, &bytes.Buffer{}, -1, nil)
+	for _, line := range []string{"let x = 1", "", "x + 1", "x + 1", "let y = 2"} {
+		e.AddHistory(line)
+	}
+	if strings.Join(e.history, "|") != "let x = 1|x + 1|let y = 2" {
+		t.Fatalf("history is %q", e.history)
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"\x1b[A\r", "let y = 2"},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "let x = 1"},
+		{"\x10\x10!\r", "x + 1!"},
+		{"typed\x1b[A\x1b[B\r", "typed"},
+		{"\x1b[A\x0e\r", ""},
+		{"\x12x +\r", "x + 1"},
+		{"\x12let\r", "let y = 2"},
+		{"\x12let\x12\r", "let x = 1"},
+		{"\x12let\x12\x12\r", "let x = 1"},
+		{"\x12y\x7f\x7fx =\r", "let x = 1"},
+		{"\x12nothing\r", ""},
+		{"typed\x12x\x07\r", "typed"},
+		{"\x12x +\x02\x02\x0b\r", "x +"},
+		{"\x12x +\x1b[A\r", "let x = 1"},
+	}
+
+	for _, tt := range tests {
+		if got := edit(t, e, tt.keys); got != tt.expected {
+			t.Errorf("keys %q read %q, want %q", tt.keys, got, tt.expected)
+		}
+	}
+}
+
+func TestEditorHistoryFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	e := newEditor(nil, &bytes.Buffer{}, -1, nil)
+	e.historyFile = file
+	e.loadHistory()
+	e.AddHistory("let a = 1")
+	e.AddHistory("a * 2")
+
+	again := newEditor(nil, &bytes.Buffer{}, -1, nil)
+	again.historyFile = file
+	again.loadHistory()
+	if got := edit(t, again, "\x1b[A\x1b[A\r"); got != "let a = 1" {
+		t.Errorf("history read back is %q", again.history)
+	}
+
+	// 太长的历史文件只保留最后的部分
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, fmt.Sprint(i))
+	}
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+
+	again.loadHistory()
+	if len(again.history) != maxHistory || again.history[0] != "10" {
+		t.Errorf("history has %d lines from %q", len(again.history), again.history[0])
+	}
+	data, _ := os.ReadFile(file)
+	if n := strings.Count(string(data), "\n"); n != maxHistory {
+		t.Errorf("history file has %d lines, want %d", n, maxHistory)
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	s := &session{env: object.NewEnvironment()}
+	s.env.Set("counter", &object.Integer{Value: 1})
+	s.env.Set("count", &object.Integer{Value: 2})
+	s.env.Set("été", &object.Integer{Value: 3})
+
+	tests := []struct {
+		keys     string
+		expected string
+		printed  string
+	}{
+		{"le\t x\r", "let x", ""},
+		{"wh\t\r", "while", ""},
+		{"co\t\r", "co", "\r\ncontinue  count  counter\r\n"},
+		{"cou\t\r", "count", ""},
+		{"count\t\r", "count", "\r\ncount  counter\r\n"},
+		{"1 + cou\t\x02\x02x\r", "1 + couxnt", ""},
+		{"ét\t\r", "été", ""},
+		{"zz\t\r", "zz", "\a"},
+		{"\t\r", "", "\a"},
+		{":se\t\r", ":sexpr", ""},
+		{":s\t\r", ":s", "\r\n:save  :sexpr\r\n"},
+		{"x :s\t\r", "x :s", "\a"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := newEditor(nil, &out, -1, s.complete)
+		if got := edit(t, e, tt.keys); got != tt.expected {
+			t.Errorf("keys %q read %q, want %q", tt.keys, got, tt.expected)
+		}
+		if tt.printed != "" && !strings.Contains(out.String(), tt.printed) {
+			t.Errorf("keys %q printed %q, want %q in it", tt.keys, out.String(), tt.printed)
+		}
+	}
+}
+
+func TestEditorInterrupt(t *testing.T) {
+	e := newEditor(strings.NewReader("fn(x) {\r\x031 + 1\r"), &bytes.Buffer{}, -1, nil)
+
+	var lines []string
+	for {
+		line, err := e.ReadLine(PROMPT)
+		if err == io.EOF {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%q %v", line, err))
+	}
+	expected := `"fn(x) {" <nil>|"" interrupted|"1 + 1" <nil>`
+	if strings.Join(lines, "|") != expected {
+		t.Errorf("read %s, want %s", strings.Join(lines, "|"), expected)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let b = 2;\nlet a = [1, b];\n:env\n", "a = [1, 2]\nb = 2\n"},
+		{"let a = 1;\n:reset\n:env\na\n", "ERROR: identifier not found: a\n"},
+		{"let a = fn() {}();\n:env\n", "a = null\n"},
+		{":reset now\n", "usage: :reset\n"},
+		{":load\n", "usage: :load file.mk\n"},
+		{":time\n", "usage: :time expr\n"},
+		{":load nothing.mk\n", "open nothing.mk: no such file or directory\n"},
+		{":ast\n:time 1 + 2\n", "3\n"},
+		{":time 1 +\n", "1 +\n   ^ no prefix parse function for EOF found\n"},
+	}
+
+	for _, tt := range tests {
+		got := run(tt.input)
+		// 时间和分配次数每次都不一样
+		if i := strings.Index(got, "time: "); i >= 0 {
+			got = got[:i]
+		}
+		if got != tt.expected {
+			t.Errorf("input %q printed\n%s\nwant\n%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPrintEnv(t *testing.T) {
+	var out bytes.Buffer
+	s := &session{out: &out, env: object.NewEnvironment(), mode: "eval"}
+	s.env.Set("a", nil)
+	s.env.Set("b", &object.Array{Elements: []object.Object{nil}})
+	s.env.Set("c", &object.Integer{Value: 1})
+
+	s.command(":env")
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 4 || lines[0] != "a = null" || !strings.HasPrefix(lines[1], "b = <ARRAY: ") || lines[2] != "c = 1" {
+		t.Fatalf("printed %q", out.String())
+	}
+}
+
+func TestTime(t *testing.T) {
+	got := run(":time let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } };\n:time f(15)\n")
+
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 3 || lines[1] != "610" {
+		t.Fatalf("printed %q", got)
+	}
+	for _, line := range []string{lines[0], lines[2]} {
+		var elapsed string
+		var allocs, bytes int
+		if _, err := fmt.Sscanf(line, "time: %s allocations: %d (%d bytes)", &elapsed, &allocs, &bytes); err != nil {
+			t.Errorf("can't read %q: %v", line, err)
+		}
+	}
+	if !strings.Contains(lines[2], "allocations: ") || strings.Contains(lines[2], "allocations: 0 ") {
+		t.Errorf("f(15) allocated nothing: %q", lines[2])
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	saved := filepath.Join(dir, "saved.mk")
+
+	os.WriteFile(script, []byte("let double = fn(x) { x * 2 };\ndouble(21)\n"), 0644)
+
+	input := fmt.Sprintf(":load %s\nlet y = double(2);\ny + z\n:ast\nlet z = 1;\n:eval\n:save %s\n", script, saved)
+	expected := fmt.Sprintf("42\nERROR: identifier not found: z\nProgram\n  LetStatement\n    Identifier z\n"+
+		"    IntegerLiteral 1\nsaved 2 inputs to %s\n", saved)
+	if got := run(input); got != expected {
+		t.Errorf("printed\n%s\nwant\n%s", got, expected)
+	}
+
+	data, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "let double = fn(x) { x * 2 };\ndouble(21)\nlet y = double(2);\n" {
+		t.Errorf("saved %q", data)
+	}
+
+	// 重新加载保存的文件能恢复会话
+	if got := run(fmt.Sprintf(":load %s\ny\n", saved)); got != "4\n" {
+		t.Errorf("reloaded session printed %q", got)
+	}
+
+	// 空行不算输入
+	blank := filepath.Join(dir, "blank.mk")
+	expected = fmt.Sprintf("saved 1 inputs to %s\n", blank)
+	if got := run(fmt.Sprintf("let a = 1;\n\n  \t\n:save %s\n", blank)); got != expected {
+		t.Errorf("saving after blank lines printed %q, want %q", got, expected)
+	}
+	if data, _ := os.ReadFile(blank); string(data) != "let a = 1;\n" {
+		t.Errorf("saved %q after blank lines", data)
+	}
+
+	os.WriteFile(script, []byte("let a = 1;\nlet = 2;\n"), 0644)
+	expected = fmt.Sprintf("let = 2;\n    ^ %s:2:5: error: expected next token to be IDENT, got = instead\n", script)
+	if got := run(":load " + script + "\n"); got != expected {
+		t.Errorf("broken script printed\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	got := run(":help\n")
+	for name, cmd := range commands {
+		if !strings.Contains(got, ":"+name) || !strings.Contains(got, cmd.usage) {
+			t.Errorf(":help doesn't show :%s", name)
+		}
+	}
+	if !strings.Contains(got, ":load file.mk") {
+		t.Errorf(":help doesn't show the argument of :load:\n%s", got)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// raw mode is only implemented for Linux, other systems read plain lines
+type termState struct{}
+
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
+
+func restore(fd int, state *termState) error { return nil }
+
+func terminalWidth(fd int) int { return 0 }
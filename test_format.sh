@@ -0,0 +1,3 @@
+#!/bin/bash
+
+go test ./format
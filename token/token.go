@@ -1,5 +1,10 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 // TokenType is constant
@@ -10,29 +15,54 @@ const (
 	// Identifiers + literals
 	IDENT = "IDENT"
 	INT = "INT"
+	FLOAT = "FLOAT"
+	STRING = "STRING"
+	COMMENT = "COMMENT"     // only appears in Token.Comments
 
 	// Operators
 	ASSIGN = "=" 
+	PLUS_ASSIGN = "+="
+	MINUS_ASSIGN = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN = "/="
+	PERCENT_ASSIGN = "%="
 	PLUS = "+" 
 	MINUS = "-" 
 	BANG = "!"
 	ASTERISK = "*"
 	SLASH = "/"
+	PERCENT = "%"
 
 	LT = "<"
 	GT = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR = "||"
+
+	BIT_AND = "&"
+	BIT_OR = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL = "<<"
+	SHR = ">>"
+
 	// Delimiters
 	COMMA = ","
 	SEMICOLON = ";"
+	COLON = ":"
+	DOT = "."
 
 	LPAREN = "(" 
 	RPAREN = ")" 
 	LBRACE = "{" 
 	RBRACE = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -42,11 +72,46 @@ const (
 	IF = "IF"
 	ELSE = "ELSE"
 	RETURN = "RETURN"
+	WHILE = "WHILE"
+	FOR = "FOR"
+	IN = "IN"
+	BREAK = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 type Token struct {
-	Type TokenType
-	Literal string
+	Type TokenType      `json:"type"`
+	Literal string      `json:"literal"`
+	Pos Position        `json:"pos"`                  // position of the first char of the token
+	End Position        `json:"end"`                  // position right after the last char, the source text is [Pos, End)
+	Comments []Token    `json:"comments,omitempty"`   // COMMENT tokens right before this token, if the lexer keeps them
+}
+
+// Position is a location in the source, Line and Column start from 1
+type Position struct {
+	Filename string `json:"filename,omitempty"`   // may be empty
+	Offset int      `json:"offset"`               // byte offset, start from 0
+	Line int        `json:"line"`
+	Column int      `json:"column"`               // byte count in the line
+	RuneColumn int  `json:"runeColumn"`           // rune count in the line
+}
+
+// IsValid : the zero Position means "no position"
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// String returns "file:line:column", "line:column" or "file" / "-" if pos is invalid
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 // map of keywords
@@ -58,8 +123,23 @@ var keywords = map[string] TokenType {
 	"if" : IF,
 	"else" : ELSE,
 	"return" : RETURN,
+	"while" : WHILE,
+	"for" : FOR,
+	"in" : IN,
+	"break" : BREAK,
+	"continue" : CONTINUE,
 } 
 
+// Keywords returns the keywords in alphabetical order, e.g. for completion
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // LookupIdent : lookup identifier
 func LookupIdent(input string) TokenType {
 	if token, ok := keywords[input]; ok {